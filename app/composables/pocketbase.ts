@@ -7,3 +7,20 @@ pb.autoCancellation(false);
 export const usePocketbase = () => {
   return pb;
 };
+
+export type BookCover = {
+  id: string;
+  collectionId: string;
+  collectionName: string;
+  cover?: string;
+  cover_url?: string;
+};
+
+// Books keep their cover as an uploaded file. cover_url is only set on rows
+// created before covers were stored, so it is the fallback.
+export const getBookCoverUrl = (book: BookCover): string => {
+  if (book.cover) {
+    return pb.getFileUrl(book, book.cover);
+  }
+  return book.cover_url ?? "";
+};
@@ -17,3 +17,28 @@ export function valueUpdater<T extends Updater<any>>(
       ? updaterOrValue(ref.value)
       : updaterOrValue;
 }
+
+// toISBN13 returns a valid ISBN-10 as its 978 prefixed ISBN-13, the form books
+// are stored in. Anything else is returned without hyphens and spaces.
+export function toISBN13(isbn: string): string {
+  const value = String(isbn).replace(/[\s-]/g, "").toUpperCase();
+  if (!/^\d{9}[\dX]$/.test(value)) {
+    return value;
+  }
+
+  let sum10 = 0;
+  for (let i = 0; i < 10; i++) {
+    sum10 += (10 - i) * (value[i] === "X" ? 10 : Number(value[i]));
+  }
+  if (sum10 % 11 !== 0) {
+    return value;
+  }
+
+  const body = "978" + value.slice(0, 9);
+  let sum13 = 0;
+  for (let i = 0; i < 12; i++) {
+    sum13 += Number(body[i]) * (i % 2 === 0 ? 1 : 3);
+  }
+
+  return body + ((10 - (sum13 % 10)) % 10);
+}
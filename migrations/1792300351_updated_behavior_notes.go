@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("zj818hrg1da8kgo")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_managebac_id := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "mbid7k2q",
+			"name": "managebac_id",
+			"type": "text",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": null,
+				"max": null,
+				"pattern": ""
+			}
+		}`), new_managebac_id); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_managebac_id)
+
+		// Existing rows have no ManageBac ID yet, so only enforce uniqueness on
+		// rows where it has been set
+		if err := json.Unmarshal([]byte(`[
+			"CREATE UNIQUE INDEX `+"`"+`idx_behavior_notes_managebac_id`+"`"+` ON `+"`"+`behavior_notes`+"`"+` (`+"`"+`managebac_id`+"`"+`) WHERE `+"`"+`managebac_id`+"`"+` != ''"
+		]`), &collection.Indexes); err != nil {
+			return err
+		}
+
+		if err := dao.SaveCollection(collection); err != nil {
+			return err
+		}
+
+		// Backfill: reset the sync cursor so the next sync refetches every note.
+		// SaveBehaviorNotes links refetched notes to their legacy rows and
+		// stores the ManageBac ID on them.
+		configRecords, err := dao.FindRecordsByFilter("config", "name='last_behavior_sync_datetime'", "", 1, 0)
+		if err != nil || len(configRecords) == 0 {
+			return nil
+		}
+
+		configRecords[0].Set("value", "")
+
+		return dao.SaveRecord(configRecords[0])
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("zj818hrg1da8kgo")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		collection.Schema.RemoveField("mbid7k2q")
+
+		collection.Indexes = types.JsonArray[string]{}
+
+		return dao.SaveCollection(collection)
+	})
+}
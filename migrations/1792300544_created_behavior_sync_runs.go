@@ -0,0 +1,179 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		jsonData := `{
+			"id": "dgb7bzbrkd6xzh2",
+			"created": "2026-10-18 09:15:44.000Z",
+			"updated": "2026-10-18 09:15:44.000Z",
+			"name": "behavior_sync_runs",
+			"type": "base",
+			"system": false,
+			"schema": [
+				{
+					"system": false,
+					"id": "f9tm9yd0",
+					"name": "trigger",
+					"type": "select",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"maxSelect": 1,
+						"values": [
+							"scheduled",
+							"manual"
+						]
+					}
+				},
+				{
+					"system": false,
+					"id": "4ewtku17",
+					"name": "status",
+					"type": "select",
+					"required": false,
+					"presentable": true,
+					"unique": false,
+					"options": {
+						"maxSelect": 1,
+						"values": [
+							"running",
+							"success",
+							"failed"
+						]
+					}
+				},
+				{
+					"system": false,
+					"id": "yygd52iq",
+					"name": "started_at",
+					"type": "date",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": "",
+						"max": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "c6j2nqvf",
+					"name": "finished_at",
+					"type": "date",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": "",
+						"max": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "yma0tafe",
+					"name": "modified_since",
+					"type": "text",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "efgayft1",
+					"name": "fetched_count",
+					"type": "number",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"noDecimal": true
+					}
+				},
+				{
+					"system": false,
+					"id": "vx9svlhh",
+					"name": "saved_count",
+					"type": "number",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"noDecimal": true
+					}
+				},
+				{
+					"system": false,
+					"id": "0s6fc411",
+					"name": "failed_count",
+					"type": "number",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"noDecimal": true
+					}
+				},
+				{
+					"system": false,
+					"id": "bn24jex4",
+					"name": "error",
+					"type": "text",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				}
+			],
+			"indexes": [
+				"CREATE INDEX ` + "`" + `idx_behavior_sync_runs_started_at` + "`" + ` ON ` + "`" + `behavior_sync_runs` + "`" + ` (` + "`" + `started_at` + "`" + `)"
+			],
+			"listRule": null,
+			"viewRule": null,
+			"createRule": null,
+			"updateRule": null,
+			"deleteRule": null,
+			"options": {}
+		}`
+
+		collection := &models.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return daos.New(db).SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("dgb7bzbrkd6xzh2")
+		if err != nil {
+			return err
+		}
+
+		return dao.DeleteCollection(collection)
+	})
+}
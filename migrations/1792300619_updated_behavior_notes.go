@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		notes, err := dao.FindCollectionByNameOrId("zj818hrg1da8kgo")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_deleted_at := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "trzo3f3k",
+			"name": "deleted_at",
+			"type": "date",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": "",
+				"max": ""
+			}
+		}`), new_deleted_at); err != nil {
+			return err
+		}
+		notes.Schema.AddField(new_deleted_at)
+
+		if err := dao.SaveCollection(notes); err != nil {
+			return err
+		}
+
+		runs, err := dao.FindCollectionByNameOrId("dgb7bzbrkd6xzh2")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_deleted_count := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "61hqe73z",
+			"name": "deleted_count",
+			"type": "number",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": null,
+				"max": null,
+				"noDecimal": true
+			}
+		}`), new_deleted_count); err != nil {
+			return err
+		}
+		runs.Schema.AddField(new_deleted_count)
+
+		return dao.SaveCollection(runs)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		notes, err := dao.FindCollectionByNameOrId("zj818hrg1da8kgo")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		notes.Schema.RemoveField("trzo3f3k")
+
+		if err := dao.SaveCollection(notes); err != nil {
+			return err
+		}
+
+		runs, err := dao.FindCollectionByNameOrId("dgb7bzbrkd6xzh2")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		runs.Schema.RemoveField("61hqe73z")
+
+		return dao.SaveCollection(runs)
+	})
+}
@@ -0,0 +1,133 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// behaviorNotesTypedFields maps the behavior_notes fields stored as text to
+// their typed replacements. The replacements get new ids so that PocketBase
+// recreates the columns with the correct definition.
+var behaviorNotesTypedFields = []struct {
+	name   string
+	textId string
+	typeId string
+	typ    string
+}{
+	{"incident_time", "sxrlmxtt", "jv0c9gnc", schema.FieldTypeDate},
+	{"next_step_date", "9s72zjbr", "2lpg4xrp", schema.FieldTypeDate},
+	{"visible_to_parents", "mojdnvyg", "b78o8ptu", schema.FieldTypeBool},
+	{"visible_to_students", "7xt4qgkv", "k8tseklb", schema.FieldTypeBool},
+	{"created_at", "flmhmzj9", "13m9b6um", schema.FieldTypeDate},
+	{"updated_at", "cio3mmih", "pj4590r5", schema.FieldTypeDate},
+}
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		return migrateBehaviorNotesFieldTypes(db, true)
+	}, func(db dbx.Builder) error {
+		return migrateBehaviorNotesFieldTypes(db, false)
+	})
+}
+
+// migrateBehaviorNotesFieldTypes swaps the text fields for typed ones (or back
+// again when up is false) and converts the existing values
+func migrateBehaviorNotesFieldTypes(db dbx.Builder, up bool) error {
+	dao := daos.New(db)
+
+	collection, err := dao.FindCollectionByNameOrId("zj818hrg1da8kgo")
+	if err != nil {
+		return err
+	}
+
+	columns := []string{"id"}
+	for _, f := range behaviorNotesTypedFields {
+		columns = append(columns, f.name)
+	}
+
+	// read the current values before the columns are recreated
+	rows := []dbx.NullStringMap{}
+	if err := db.Select(columns...).From(collection.Name).All(&rows); err != nil {
+		return err
+	}
+
+	fields := []*schema.SchemaField{}
+	for _, field := range collection.Schema.Fields() {
+		replaced := false
+		for _, f := range behaviorNotesTypedFields {
+			if up && field.Id == f.textId {
+				fields = append(fields, behaviorNotesField(f.typeId, f.name, f.typ))
+				replaced = true
+			} else if !up && field.Id == f.typeId {
+				fields = append(fields, behaviorNotesField(f.textId, f.name, schema.FieldTypeText))
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			fields = append(fields, field)
+		}
+	}
+	collection.Schema = schema.NewSchema(fields...)
+
+	if err := dao.SaveCollection(collection); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		params := dbx.Params{}
+		for _, f := range behaviorNotesTypedFields {
+			raw := row[f.name].String
+
+			switch {
+			case f.typ == schema.FieldTypeBool && up:
+				params[f.name] = raw == "true" || raw == "1"
+			case f.typ == schema.FieldTypeBool:
+				if raw == "1" || raw == "true" {
+					params[f.name] = "true"
+				} else {
+					params[f.name] = "false"
+				}
+			case up:
+				// ManageBac values are RFC3339 timestamps or plain dates,
+				// unparsable values are dropped rather than kept as text
+				date, err := types.ParseDateTime(raw)
+				if err != nil {
+					date = types.DateTime{}
+				}
+				params[f.name] = date.String()
+			default:
+				params[f.name] = raw
+			}
+		}
+
+		if _, err := db.Update(collection.Name, params, dbx.HashExp{"id": row["id"].String}).Execute(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func behaviorNotesField(id string, name string, typ string) *schema.SchemaField {
+	field := &schema.SchemaField{
+		System: false,
+		Id:     id,
+		Name:   name,
+		Type:   typ,
+	}
+
+	switch typ {
+	case schema.FieldTypeDate:
+		field.Options = &schema.DateOptions{}
+	case schema.FieldTypeBool:
+		field.Options = &schema.BoolOptions{}
+	default:
+		field.Options = &schema.TextOptions{}
+	}
+
+	return field
+}
@@ -0,0 +1,200 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		jsonData := `{
+			"id": "1on37ic9xwz3mod",
+			"created": "2026-10-18 09:27:20.000Z",
+			"updated": "2026-10-18 09:27:20.000Z",
+			"name": "detention_rules",
+			"type": "base",
+			"system": false,
+			"schema": [
+				{
+					"system": false,
+					"id": "hy1wa2dw",
+					"name": "name",
+					"type": "text",
+					"required": true,
+					"presentable": true,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "rbqg0smr",
+					"name": "match_field",
+					"type": "select",
+					"required": true,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"maxSelect": 1,
+						"values": [
+							"next_step",
+							"behavior_type"
+						]
+					}
+				},
+				{
+					"system": false,
+					"id": "0jfcylbk",
+					"name": "pattern",
+					"type": "text",
+					"required": true,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "ovw68nv4",
+					"name": "category",
+					"type": "select",
+					"required": true,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"maxSelect": 1,
+						"values": [
+							"lunchtime",
+							"after_school",
+							"saturday",
+							"internal_exclusion"
+						]
+					}
+				},
+				{
+					"system": false,
+					"id": "19auniku",
+					"name": "severity",
+					"type": "number",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": 0,
+						"max": null,
+						"noDecimal": false
+					}
+				},
+				{
+					"system": false,
+					"id": "5nz4iu0w",
+					"name": "priority",
+					"type": "number",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"noDecimal": true
+					}
+				},
+				{
+					"system": false,
+					"id": "cdss2z1u",
+					"name": "include_in_report",
+					"type": "bool",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {}
+				},
+				{
+					"system": false,
+					"id": "u1oov4kl",
+					"name": "active",
+					"type": "bool",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {}
+				}
+			],
+			"indexes": [],
+			"listRule": null,
+			"viewRule": null,
+			"createRule": null,
+			"updateRule": null,
+			"deleteRule": null,
+			"options": {}
+		}`
+
+		collection := &models.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		dao := daos.New(db)
+
+		if err := dao.SaveCollection(collection); err != nil {
+			return err
+		}
+
+		// Seed the rules that were previously hardcoded: "Detention" notes are
+		// reported, and both they and "Lunchtime" notes count towards double
+		// detentions. Lunchtime is checked first so "Lunchtime Detention" is
+		// categorised as lunchtime.
+		seeds := []map[string]any{
+			{
+				"name":              "Detention",
+				"match_field":       "next_step",
+				"pattern":           "Detention",
+				"category":          "after_school",
+				"severity":          1,
+				"priority":          20,
+				"include_in_report": true,
+				"active":            true,
+			},
+			{
+				"name":              "Lunchtime",
+				"match_field":       "next_step",
+				"pattern":           "Lunchtime",
+				"category":          "lunchtime",
+				"severity":          1,
+				"priority":          10,
+				"include_in_report": false,
+				"active":            true,
+			},
+		}
+
+		for _, seed := range seeds {
+			record := models.NewRecord(collection)
+			record.Load(seed)
+
+			if err := dao.SaveRecord(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("1on37ic9xwz3mod")
+		if err != nil {
+			return err
+		}
+
+		return dao.DeleteCollection(collection)
+	})
+}
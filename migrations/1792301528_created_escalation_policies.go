@@ -0,0 +1,182 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		jsonData := `{
+			"id": "kj1t6kwv17y8np6",
+			"created": "2026-10-18 05:32:08.000Z",
+			"updated": "2026-10-18 05:32:08.000Z",
+			"name": "escalation_policies",
+			"type": "base",
+			"system": false,
+			"schema": [
+				{
+					"system": false,
+					"id": "60x7mjdc",
+					"name": "name",
+					"type": "text",
+					"required": true,
+					"presentable": true,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "f9rchhgz",
+					"name": "level",
+					"type": "number",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"noDecimal": true
+					}
+				},
+				{
+					"system": false,
+					"id": "44313vn9",
+					"name": "window_days",
+					"type": "number",
+					"required": true,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": 1,
+						"max": null,
+						"noDecimal": true
+					}
+				},
+				{
+					"system": false,
+					"id": "52hjirf8",
+					"name": "threshold",
+					"type": "number",
+					"required": true,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"noDecimal": false
+					}
+				},
+				{
+					"system": false,
+					"id": "ob0cgqqo",
+					"name": "categories",
+					"type": "select",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"maxSelect": 4,
+						"values": [
+							"lunchtime",
+							"after_school",
+							"saturday",
+							"internal_exclusion"
+						]
+					}
+				},
+				{
+					"system": false,
+					"id": "rlxfkduj",
+					"name": "action",
+					"type": "text",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "oo0zhoqv",
+					"name": "active",
+					"type": "bool",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {}
+				}
+			],
+			"indexes": [],
+			"listRule": null,
+			"viewRule": null,
+			"createRule": null,
+			"updateRule": null,
+			"deleteRule": null,
+			"options": {}
+		}`
+
+		collection := &models.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		dao := daos.New(db)
+
+		if err := dao.SaveCollection(collection); err != nil {
+			return err
+		}
+
+		// Seed the pastoral policy tiers. The first replaces the hardcoded
+		// double detention check of 2 detentions in 7 days.
+		seeds := []map[string]any{
+			{
+				"name":        "Double detention",
+				"level":       1,
+				"window_days": 7,
+				"threshold":   2,
+				"action":      "Head of year alert",
+				"active":      true,
+			},
+			{
+				"name":        "Repeated detentions",
+				"level":       2,
+				"window_days": 30,
+				"threshold":   4,
+				"action":      "Parent meeting",
+				"active":      true,
+			},
+		}
+
+		for _, seed := range seeds {
+			record := models.NewRecord(collection)
+			record.Load(seed)
+
+			if err := dao.SaveRecord(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("kj1t6kwv17y8np6")
+		if err != nil {
+			return err
+		}
+
+		return dao.DeleteCollection(collection)
+	})
+}
@@ -0,0 +1,105 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("02ats64dzd7u0ke")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_grades := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "p3xpwjgs",
+			"name": "grades",
+			"type": "text",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": null,
+				"max": null,
+				"pattern": ""
+			}
+		}`), new_grades); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_grades)
+
+		// add
+		new_homeroom_advisor := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "kmhyccqz",
+			"name": "homeroom_advisor",
+			"type": "text",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": null,
+				"max": null,
+				"pattern": ""
+			}
+		}`), new_homeroom_advisor); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_homeroom_advisor)
+
+		// add
+		new_categories := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "9typxt4y",
+			"name": "categories",
+			"type": "select",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"maxSelect": 4,
+				"values": [
+					"lunchtime",
+					"after_school",
+					"saturday",
+					"internal_exclusion"
+				]
+			}
+		}`), new_categories); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_categories)
+
+		return dao.SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("02ats64dzd7u0ke")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		collection.Schema.RemoveField("p3xpwjgs")
+
+		// remove
+		collection.Schema.RemoveField("kmhyccqz")
+
+		// remove
+		collection.Schema.RemoveField("9typxt4y")
+
+		return dao.SaveCollection(collection)
+	})
+}
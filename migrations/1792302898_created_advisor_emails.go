@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		jsonData := `{
+			"id": "dmas3iilx6tazkq",
+			"created": "2026-10-18 05:54:58.000Z",
+			"updated": "2026-10-18 05:54:58.000Z",
+			"name": "advisor_emails",
+			"type": "base",
+			"system": false,
+			"schema": [
+				{
+					"system": false,
+					"id": "kd28g7ar",
+					"name": "homeroom_advisor",
+					"type": "text",
+					"required": true,
+					"presentable": true,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "ei7orl4y",
+					"name": "email",
+					"type": "email",
+					"required": true,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"exceptDomains": null,
+						"onlyDomains": null
+					}
+				}
+			],
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_advisor_emails_advisor` + "`" + ` ON ` + "`" + `advisor_emails` + "`" + ` (` + "`" + `homeroom_advisor` + "`" + `)"
+			],
+			"listRule": "@request.auth.id != \"\"",
+			"viewRule": "@request.auth.id != \"\"",
+			"createRule": "@request.auth.id != \"\"",
+			"updateRule": "@request.auth.id != \"\"",
+			"deleteRule": "@request.auth.id != \"\"",
+			"options": {}
+		}`
+
+		collection := &models.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return daos.New(db).SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("dmas3iilx6tazkq")
+		if err != nil {
+			return err
+		}
+
+		return dao.DeleteCollection(collection)
+	})
+}
@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("410vkrq314e2vl2")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_returned_at := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "fcg1xnzj",
+			"name": "returned_at",
+			"type": "date",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": "",
+				"max": ""
+			}
+		}`), new_returned_at); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_returned_at)
+
+		// add
+		new_condition := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "tmahuyjs",
+			"name": "condition",
+			"type": "select",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"maxSelect": 1,
+				"values": [
+					"good",
+					"damaged",
+					"lost"
+				]
+			}
+		}`), new_condition); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_condition)
+
+		// add
+		new_condition_notes := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "ijufn22k",
+			"name": "condition_notes",
+			"type": "text",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": null,
+				"max": null,
+				"pattern": ""
+			}
+		}`), new_condition_notes); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_condition_notes)
+
+		return dao.SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("410vkrq314e2vl2")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		collection.Schema.RemoveField("fcg1xnzj")
+
+		// remove
+		collection.Schema.RemoveField("tmahuyjs")
+
+		// remove
+		collection.Schema.RemoveField("ijufn22k")
+
+		return dao.SaveCollection(collection)
+	})
+}
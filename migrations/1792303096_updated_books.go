@@ -0,0 +1,78 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("5k0uz7zn0m27i18")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_department := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "z6ocf2ad",
+			"name": "department",
+			"type": "text",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": null,
+				"max": null,
+				"pattern": ""
+			}
+		}`), new_department); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_department)
+
+		// add
+		new_loan_days := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "ip5k85x9",
+			"name": "loan_days",
+			"type": "number",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": 0,
+				"max": null,
+				"noDecimal": true
+			}
+		}`), new_loan_days); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_loan_days)
+
+		return dao.SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("5k0uz7zn0m27i18")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		collection.Schema.RemoveField("z6ocf2ad")
+
+		// remove
+		collection.Schema.RemoveField("ip5k85x9")
+
+		return dao.SaveCollection(collection)
+	})
+}
@@ -0,0 +1,107 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("410vkrq314e2vl2")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_due_at := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "faci9tpc",
+			"name": "due_at",
+			"type": "date",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": "",
+				"max": ""
+			}
+		}`), new_due_at); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_due_at)
+
+		// add
+		new_reminders_sent := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "mmj4dmf8",
+			"name": "reminders_sent",
+			"type": "number",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": 0,
+				"max": null,
+				"noDecimal": true
+			}
+		}`), new_reminders_sent); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_reminders_sent)
+
+		// add
+		new_last_reminded_at := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "i2ac3pz0",
+			"name": "last_reminded_at",
+			"type": "date",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"min": "",
+				"max": ""
+			}
+		}`), new_last_reminded_at); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_last_reminded_at)
+
+		if err := dao.SaveCollection(collection); err != nil {
+			return err
+		}
+
+		// Open rentals get the default loan period from now rather than from
+		// when they were made, so books already out are not overdue straight away
+		_, err = db.NewQuery("UPDATE rentals SET due_at = strftime('%Y-%m-%d %H:%M:%fZ', 'now', '+14 days') WHERE returned_at = '' OR returned_at IS NULL").Execute()
+
+		return err
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("410vkrq314e2vl2")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		collection.Schema.RemoveField("faci9tpc")
+
+		// remove
+		collection.Schema.RemoveField("mmj4dmf8")
+
+		// remove
+		collection.Schema.RemoveField("i2ac3pz0")
+
+		return dao.SaveCollection(collection)
+	})
+}
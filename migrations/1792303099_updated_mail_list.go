@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("02ats64dzd7u0ke")
+		if err != nil {
+			return err
+		}
+
+		// update
+		edit_subs := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "ggwqu9of",
+			"name": "subs",
+			"type": "select",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"maxSelect": 3,
+				"values": [
+					"behavior",
+					"summary",
+					"library"
+				]
+			}
+		}`), edit_subs); err != nil {
+			return err
+		}
+		collection.Schema.AddField(edit_subs)
+
+		return dao.SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("02ats64dzd7u0ke")
+		if err != nil {
+			return err
+		}
+
+		// update
+		edit_subs := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "ggwqu9of",
+			"name": "subs",
+			"type": "select",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"maxSelect": 2,
+				"values": [
+					"behavior",
+					"summary"
+				]
+			}
+		}`), edit_subs); err != nil {
+			return err
+		}
+		collection.Schema.AddField(edit_subs)
+
+		return dao.SaveCollection(collection)
+	})
+}
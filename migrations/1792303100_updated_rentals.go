@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("410vkrq314e2vl2")
+		if err != nil {
+			return err
+		}
+
+		// Copies rented out twice before the index existed keep their newest
+		// open rental, the older ones are closed with a note saying why
+		_, err = db.NewQuery(`
+			UPDATE rentals
+			SET returned_at = strftime('%Y-%m-%d %H:%M:%fZ', 'now'),
+				condition_notes = TRIM(condition_notes || char(10) || 'closed by migration: duplicate open rental', char(10))
+			WHERE returned_at = '' AND EXISTS (
+				SELECT 1 FROM rentals newer
+				WHERE newer.book_instance = rentals.book_instance
+					AND newer.returned_at = ''
+					AND (newer.created > rentals.created OR (newer.created = rentals.created AND newer.id > rentals.id))
+			)
+		`).Execute()
+		if err != nil {
+			return err
+		}
+
+		// A copy can only have one open rental, even when two are made at once
+		if err := json.Unmarshal([]byte(`[
+			"CREATE UNIQUE INDEX `+"`"+`idx_rentals_open_copy`+"`"+` ON `+"`"+`rentals`+"`"+` (`+"`"+`book_instance`+"`"+`) WHERE `+"`"+`returned_at`+"`"+` = ''"
+		]`), &collection.Indexes); err != nil {
+			return err
+		}
+
+		return dao.SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("410vkrq314e2vl2")
+		if err != nil {
+			return err
+		}
+
+		collection.Indexes = types.JsonArray[string]{}
+
+		return dao.SaveCollection(collection)
+	})
+}
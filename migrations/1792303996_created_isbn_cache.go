@@ -0,0 +1,232 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		jsonData := `{
+			"id": "o46dyxqlb38zhuw",
+			"created": "2026-10-18 06:13:16.000Z",
+			"updated": "2026-10-18 06:13:16.000Z",
+			"name": "isbn_cache",
+			"type": "base",
+			"system": false,
+			"schema": [
+				{
+					"system": false,
+					"id": "mwvkx8r0",
+					"name": "isbn13",
+					"type": "text",
+					"required": true,
+					"presentable": true,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "h9rzqt55",
+					"name": "isbn10",
+					"type": "text",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "rd3yew10",
+					"name": "found",
+					"type": "bool",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {}
+				},
+				{
+					"system": false,
+					"id": "rm6jkjtj",
+					"name": "title",
+					"type": "text",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "8kv6qpqf",
+					"name": "subtitle",
+					"type": "text",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "muzwro51",
+					"name": "authors",
+					"type": "json",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"maxSize": 2000000
+					}
+				},
+				{
+					"system": false,
+					"id": "n2t2s942",
+					"name": "publisher",
+					"type": "text",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "2xgvnafq",
+					"name": "published_date",
+					"type": "text",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "t35k799b",
+					"name": "page_count",
+					"type": "number",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": 0,
+						"max": null,
+						"noDecimal": true
+					}
+				},
+				{
+					"system": false,
+					"id": "etcwxwnt",
+					"name": "source",
+					"type": "text",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "xqysr15g",
+					"name": "cover",
+					"type": "file",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"mimeTypes": [
+							"image/jpg",
+							"image/jpeg",
+							"image/png",
+							"image/gif",
+							"image/webp"
+						],
+						"thumbs": null,
+						"maxSelect": 1,
+						"maxSize": 5242880,
+						"protected": false
+					}
+				},
+				{
+					"system": false,
+					"id": "qrx2s9cb",
+					"name": "cover_source_url",
+					"type": "url",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"exceptDomains": null,
+						"onlyDomains": null
+					}
+				},
+				{
+					"system": false,
+					"id": "z7v5e47d",
+					"name": "fetched_at",
+					"type": "date",
+					"required": false,
+					"presentable": false,
+					"unique": false,
+					"options": {
+						"min": "",
+						"max": ""
+					}
+				}
+			],
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_isbn_cache_isbn13` + "`" + ` ON ` + "`" + `isbn_cache` + "`" + ` (` + "`" + `isbn13` + "`" + `)"
+			],
+			"listRule": "@request.auth.id != \"\"",
+			"viewRule": "@request.auth.id != \"\"",
+			"createRule": null,
+			"updateRule": null,
+			"deleteRule": null,
+			"options": {}
+		}`
+
+		collection := &models.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return daos.New(db).SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("o46dyxqlb38zhuw")
+		if err != nil {
+			return err
+		}
+
+		return dao.DeleteCollection(collection)
+	})
+}
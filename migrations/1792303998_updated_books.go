@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("5k0uz7zn0m27i18")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_cover := &schema.SchemaField{}
+		if err := json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "6ue6cgd9",
+			"name": "cover",
+			"type": "file",
+			"required": false,
+			"presentable": false,
+			"unique": false,
+			"options": {
+				"mimeTypes": [
+					"image/jpg",
+					"image/jpeg",
+					"image/png",
+					"image/gif",
+					"image/webp"
+				],
+				"thumbs": null,
+				"maxSelect": 1,
+				"maxSize": 5242880,
+				"protected": false
+			}
+		}`), new_cover); err != nil {
+			return err
+		}
+		collection.Schema.AddField(new_cover)
+
+		return dao.SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("5k0uz7zn0m27i18")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		collection.Schema.RemoveField("6ue6cgd9")
+
+		return dao.SaveCollection(collection)
+	})
+}
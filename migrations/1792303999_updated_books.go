@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/veritymedia/massolit/pocketbase/isbn"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		// Books are looked up by ISBN-13, so rewrite the ISBN-10s saved
+		// before ISBNs were normalized. isbn is a number field, which drops
+		// the leading zeros of an ISBN-10.
+		rows := []struct {
+			Id   string `db:"id"`
+			Isbn int64  `db:"isbn"`
+		}{}
+		if err := db.NewQuery("SELECT id, CAST(isbn AS INTEGER) AS isbn FROM books").All(&rows); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			value := strconv.FormatInt(row.Isbn, 10)
+			if len(value) > 10 {
+				continue
+			}
+
+			isbn13, err := isbn.To13(strings.Repeat("0", 10-len(value)) + value)
+			if err != nil {
+				continue
+			}
+
+			if _, err := db.NewQuery("UPDATE books SET isbn = {:isbn} WHERE id = {:id}").
+				Bind(dbx.Params{"isbn": isbn13, "id": row.Id}).
+				Execute(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(db dbx.Builder) error {
+		// The original ISBN-10s are not kept, and ISBN-13s find the same books
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package isbn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MaxCoverSize is the largest cover image FetchCover will download
+const MaxCoverSize = 5 << 20
+
+// coverClient downloads cover images
+var coverClient = &http.Client{Timeout: DefaultTimeout}
+
+// FetchCover downloads a cover image, returning its bytes and content type.
+// Responses that are not images or are larger than MaxCoverSize are refused.
+func FetchCover(ctx context.Context, coverURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, coverURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", DefaultUserAgent)
+
+	resp, err := coverClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error downloading cover: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("cover download returned status code %d", resp.StatusCode)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("cover is not an image: %s", contentType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxCoverSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading cover: %v", err)
+	}
+	if len(data) > MaxCoverSize {
+		return nil, "", fmt.Errorf("cover is larger than %d bytes", MaxCoverSize)
+	}
+
+	return data, contentType, nil
+}
@@ -0,0 +1,97 @@
+package isbn
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// GoogleBooksBaseURL is the Google Books API root
+const GoogleBooksBaseURL = "https://www.googleapis.com/books/v1"
+
+// GoogleBooks looks books up in the Google Books volumes API
+type GoogleBooks struct {
+	source
+	apiKey string
+}
+
+// NewGoogleBooks creates a Google Books provider. The API key is optional
+// but raises Google's rate limits.
+func NewGoogleBooks(apiKey string, opts ...Option) *GoogleBooks {
+	return &GoogleBooks{
+		source: newSource(GoogleBooksBaseURL, opts),
+		apiKey: apiKey,
+	}
+}
+
+func (g *GoogleBooks) Name() string {
+	return "google_books"
+}
+
+type googleVolumes struct {
+	TotalItems int `json:"totalItems"`
+	Items      []struct {
+		VolumeInfo struct {
+			Title         string   `json:"title"`
+			Subtitle      string   `json:"subtitle"`
+			Authors       []string `json:"authors"`
+			Publisher     string   `json:"publisher"`
+			PublishedDate string   `json:"publishedDate"`
+			PageCount     int      `json:"pageCount"`
+			ImageLinks    struct {
+				SmallThumbnail string `json:"smallThumbnail"`
+				Thumbnail      string `json:"thumbnail"`
+				Small          string `json:"small"`
+				Medium         string `json:"medium"`
+				Large          string `json:"large"`
+				ExtraLarge     string `json:"extraLarge"`
+			} `json:"imageLinks"`
+		} `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+func (g *GoogleBooks) Lookup(ctx context.Context, isbn13 string) (*Book, error) {
+	params := url.Values{"q": {"isbn:" + isbn13}}
+	if g.apiKey != "" {
+		params.Set("key", g.apiKey)
+	}
+
+	var volumes googleVolumes
+	if err := g.getJSON(ctx, g.baseURL+"/volumes?"+params.Encode(), &volumes); err != nil {
+		return nil, err
+	}
+
+	if volumes.TotalItems == 0 || len(volumes.Items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	info := volumes.Items[0].VolumeInfo
+	images := info.ImageLinks
+
+	return &Book{
+		Title:         info.Title,
+		Subtitle:      info.Subtitle,
+		Authors:       info.Authors,
+		Publisher:     info.Publisher,
+		PublishedDate: info.PublishedDate,
+		PageCount:     info.PageCount,
+		CoverURL:      httpsURL(firstNonEmpty(images.ExtraLarge, images.Large, images.Medium, images.Small, images.Thumbnail, images.SmallThumbnail)),
+	}, nil
+}
+
+// httpsURL upgrades the http image links Google returns
+func httpsURL(link string) string {
+	if strings.HasPrefix(link, "http://") {
+		return "https://" + strings.TrimPrefix(link, "http://")
+	}
+	return link
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+// Package isbn validates ISBNs and looks up book details from online
+// providers.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalid is returned for a value that is not a valid ISBN-10 or ISBN-13
+	ErrInvalid = errors.New("isbn: invalid ISBN")
+
+	// ErrNoISBN10 is returned when converting an ISBN-13 outside the 978
+	// prefix, which has no ISBN-10
+	ErrNoISBN10 = errors.New("isbn: ISBN-13 has no ISBN-10 equivalent")
+)
+
+// Normalize removes hyphens and spaces and upper-cases an ISBN-10 X check
+// digit. It does not validate the result.
+func Normalize(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(value) {
+		if r == '-' || r == ' ' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// IsValid10 reports whether value is an ISBN-10 with a correct check digit
+func IsValid10(value string) bool {
+	value = Normalize(value)
+	if len(value) != 10 {
+		return false
+	}
+
+	sum := 0
+	for i, r := range value {
+		var digit int
+		switch {
+		case r >= '0' && r <= '9':
+			digit = int(r - '0')
+		case r == 'X' && i == 9:
+			digit = 10
+		default:
+			return false
+		}
+		sum += (10 - i) * digit
+	}
+
+	return sum%11 == 0
+}
+
+// IsValid13 reports whether value is an ISBN-13 with a correct check digit
+func IsValid13(value string) bool {
+	value = Normalize(value)
+	if len(value) != 13 || !isDigits(value) {
+		return false
+	}
+
+	return checkDigit13(value[:12]) == value[12]
+}
+
+// Parse validates an ISBN-10 or ISBN-13 and returns it as an ISBN-13
+func Parse(value string) (string, error) {
+	value = Normalize(value)
+
+	switch {
+	case IsValid13(value):
+		return value, nil
+	case IsValid10(value):
+		return To13(value)
+	}
+
+	return "", ErrInvalid
+}
+
+// To13 converts an ISBN-10 to its 978 prefixed ISBN-13
+func To13(isbn10 string) (string, error) {
+	isbn10 = Normalize(isbn10)
+	if !IsValid10(isbn10) {
+		return "", ErrInvalid
+	}
+
+	body := "978" + isbn10[:9]
+
+	return body + string(checkDigit13(body)), nil
+}
+
+// To10 converts a 978 prefixed ISBN-13 to an ISBN-10
+func To10(isbn13 string) (string, error) {
+	isbn13 = Normalize(isbn13)
+	if !IsValid13(isbn13) {
+		return "", ErrInvalid
+	}
+	if !strings.HasPrefix(isbn13, "978") {
+		return "", ErrNoISBN10
+	}
+
+	body := isbn13[3:12]
+
+	return body + string(checkDigit10(body)), nil
+}
+
+func checkDigit13(body string) byte {
+	sum := 0
+	for i, r := range body {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(r-'0')
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+func checkDigit10(body string) byte {
+	sum := 0
+	for i, r := range body {
+		sum += (10 - i) * int(r-'0')
+	}
+
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+
+	return byte('0' + check)
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
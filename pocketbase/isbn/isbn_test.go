@@ -0,0 +1,161 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"0140449132", "0140449132"},
+		{"0-14-044913-2", "0140449132"},
+		{"0 14 044913 2", "0140449132"},
+		{"080442957x", "080442957X"},
+		{"978-0-14-044913-6", "9780140449136"},
+		{" 978 0140 449136 ", "9780140449136"},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.value); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsValid10(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"0140449132", true},
+		{"0-14-044913-2", true},
+		{"080442957X", true},
+		{"080442957x", true},
+		{"0140449133", false},
+		{"0804429570", false},
+		{"X804429573", false},
+		{"014044913", false},
+		{"01404491322", false},
+		{"014044913A", false},
+		{"9780140449136", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsValid10(tt.value); got != tt.want {
+			t.Errorf("IsValid10(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsValid13(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"9780140449136", true},
+		{"978-0-14-044913-6", true},
+		{"978 0 14 044913 6", true},
+		{"9780804429573", true},
+		{"9791032305690", true},
+		{"9780140449137", false},
+		{"9791032305691", false},
+		{"978014044913X", false},
+		{"978014044913", false},
+		{"97801404491366", false},
+		{"0140449132", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsValid13(tt.value); got != tt.want {
+			t.Errorf("IsValid13(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr error
+	}{
+		{"9780140449136", "9780140449136", nil},
+		{"978-0-14-044913-6", "9780140449136", nil},
+		{"0140449132", "9780140449136", nil},
+		{"0-14-044913-2", "9780140449136", nil},
+		{"0 14 044913 2", "9780140449136", nil},
+		{"080442957X", "9780804429573", nil},
+		{"080442957x", "9780804429573", nil},
+		{"9791032305690", "9791032305690", nil},
+		{"0140449133", "", ErrInvalid},
+		{"9780140449137", "", ErrInvalid},
+		{"not an isbn", "", ErrInvalid},
+		{"", "", ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.value)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestTo13(t *testing.T) {
+	tests := []struct {
+		isbn10  string
+		want    string
+		wantErr error
+	}{
+		{"0140449132", "9780140449136", nil},
+		{"0-14-044913-2", "9780140449136", nil},
+		{"080442957X", "9780804429573", nil},
+		{"0140449133", "", ErrInvalid},
+		{"9780140449136", "", ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		got, err := To13(tt.isbn10)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("To13(%q) error = %v, want %v", tt.isbn10, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("To13(%q) = %q, want %q", tt.isbn10, got, tt.want)
+		}
+	}
+}
+
+func TestTo10(t *testing.T) {
+	tests := []struct {
+		isbn13  string
+		want    string
+		wantErr error
+	}{
+		{"9780140449136", "0140449132", nil},
+		{"978-0-14-044913-6", "0140449132", nil},
+		{"9780804429573", "080442957X", nil},
+		{"9791032305690", "", ErrNoISBN10},
+		{"9780140449137", "", ErrInvalid},
+		{"0140449132", "", ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		got, err := To10(tt.isbn13)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("To10(%q) error = %v, want %v", tt.isbn13, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("To10(%q) = %q, want %q", tt.isbn13, got, tt.want)
+		}
+	}
+}
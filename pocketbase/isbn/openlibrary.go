@@ -0,0 +1,78 @@
+package isbn
+
+import (
+	"context"
+	"net/url"
+)
+
+// OpenLibraryBaseURL is the Open Library root
+const OpenLibraryBaseURL = "https://openlibrary.org"
+
+// OpenLibrary looks books up in the Open Library books API
+type OpenLibrary struct {
+	source
+}
+
+// NewOpenLibrary creates an Open Library provider
+func NewOpenLibrary(opts ...Option) *OpenLibrary {
+	return &OpenLibrary{source: newSource(OpenLibraryBaseURL, opts)}
+}
+
+func (o *OpenLibrary) Name() string {
+	return "open_library"
+}
+
+type openLibraryName struct {
+	Name string `json:"name"`
+}
+
+type openLibraryBook struct {
+	Title         string            `json:"title"`
+	Subtitle      string            `json:"subtitle"`
+	Authors       []openLibraryName `json:"authors"`
+	Publishers    []openLibraryName `json:"publishers"`
+	PublishDate   string            `json:"publish_date"`
+	NumberOfPages int               `json:"number_of_pages"`
+	Cover         struct {
+		Small  string `json:"small"`
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"cover"`
+}
+
+func (o *OpenLibrary) Lookup(ctx context.Context, isbn13 string) (*Book, error) {
+	key := "ISBN:" + isbn13
+	params := url.Values{
+		"bibkeys": {key},
+		"format":  {"json"},
+		"jscmd":   {"data"},
+	}
+
+	// The response is keyed by bibkey and empty if the book is unknown
+	var books map[string]openLibraryBook
+	if err := o.getJSON(ctx, o.baseURL+"/api/books?"+params.Encode(), &books); err != nil {
+		return nil, err
+	}
+
+	found, ok := books[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	book := &Book{
+		Title:         found.Title,
+		Subtitle:      found.Subtitle,
+		PublishedDate: found.PublishDate,
+		PageCount:     found.NumberOfPages,
+		CoverURL:      firstNonEmpty(found.Cover.Large, found.Cover.Medium, found.Cover.Small),
+	}
+
+	for _, author := range found.Authors {
+		book.Authors = append(book.Authors, author.Name)
+	}
+	if len(found.Publishers) > 0 {
+		book.Publisher = found.Publishers[0].Name
+	}
+
+	return book, nil
+}
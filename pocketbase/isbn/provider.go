@@ -0,0 +1,186 @@
+package isbn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds every request made to a provider
+	DefaultTimeout = 15 * time.Second
+
+	// DefaultUserAgent is sent with every request unless overridden
+	DefaultUserAgent = "massolit"
+)
+
+// ErrNotFound is returned when a provider has no book for an ISBN
+var ErrNotFound = errors.New("isbn: book not found")
+
+// Book is what a provider knows about an ISBN
+type Book struct {
+	ISBN13        string   `json:"isbn13"`
+	ISBN10        string   `json:"isbn10"`
+	Title         string   `json:"title"`
+	Subtitle      string   `json:"subtitle"`
+	Authors       []string `json:"authors"`
+	Publisher     string   `json:"publisher"`
+	PublishedDate string   `json:"published_date"`
+	PageCount     int      `json:"page_count"`
+	CoverURL      string   `json:"cover_url"`
+	Source        string   `json:"source"`
+}
+
+// merge fills the fields of b that are empty from other
+func (b *Book) merge(other *Book) {
+	if b.Title == "" {
+		b.Title = other.Title
+		b.Subtitle = other.Subtitle
+	}
+	if len(b.Authors) == 0 {
+		b.Authors = other.Authors
+	}
+	if b.Publisher == "" {
+		b.Publisher = other.Publisher
+	}
+	if b.PublishedDate == "" {
+		b.PublishedDate = other.PublishedDate
+	}
+	if b.PageCount == 0 {
+		b.PageCount = other.PageCount
+	}
+	if b.CoverURL == "" {
+		b.CoverURL = other.CoverURL
+	}
+}
+
+// Provider looks up books by ISBN-13. Lookup returns ErrNotFound if the
+// provider does not know the book.
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, isbn13 string) (*Book, error)
+}
+
+// Chain asks each provider in turn. The first provider to find the book
+// wins; later providers are only asked to fill in a missing title or cover.
+type Chain []Provider
+
+// Lookup resolves isbn13 through the chain. It returns ErrNotFound only if
+// every provider answered that it does not know the book, so a provider being
+// down is not mistaken for a missing book.
+func (c Chain) Lookup(ctx context.Context, isbn13 string) (*Book, error) {
+	var book *Book
+	var errs []error
+
+	for _, provider := range c {
+		found, err := provider.Lookup(ctx, isbn13)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("isbn: %s lookup of %s failed: %v", provider.Name(), isbn13, err)
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			continue
+		}
+
+		if book == nil {
+			book = found
+			book.Source = provider.Name()
+		} else {
+			book.merge(found)
+		}
+
+		if book.Title != "" && book.CoverURL != "" {
+			break
+		}
+	}
+
+	if book == nil {
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+		return nil, ErrNotFound
+	}
+
+	book.ISBN13 = isbn13
+	if isbn10, err := To10(isbn13); err == nil {
+		book.ISBN10 = isbn10
+	}
+
+	return book, nil
+}
+
+// source holds the HTTP settings shared by the online providers
+type source struct {
+	baseURL    string
+	userAgent  string
+	httpClient *http.Client
+}
+
+// Option configures an online provider
+type Option func(*source)
+
+// WithBaseURL overrides the API root, eg. to point a provider at a test server
+func WithBaseURL(baseURL string) Option {
+	return func(s *source) {
+		s.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithHTTPClient replaces the underlying http.Client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(s *source) {
+		s.httpClient = httpClient
+	}
+}
+
+func newSource(baseURL string, opts []Option) source {
+	s := source{
+		baseURL:    baseURL,
+		userAgent:  DefaultUserAgent,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+	}
+
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	return s
+}
+
+// getJSON performs a GET request and decodes the JSON response into out. A
+// 404 is returned as ErrNotFound.
+func (s source) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", s.userAgent)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("API returned status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package labels
+
+import (
+	"errors"
+	"sort"
+)
+
+// DefaultLayout is used when no layout is asked for
+const DefaultLayout = "avery-l7160"
+
+// ErrUnknownLayout is returned for a layout name that is not in Layouts
+var ErrUnknownLayout = errors.New("labels: unknown layout")
+
+// Layout describes a sheet of sticker labels. All sizes are in millimetres.
+type Layout struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	PageWidth   float64 `json:"page_width"`
+	PageHeight  float64 `json:"page_height"`
+	Columns     int     `json:"columns"`
+	Rows        int     `json:"rows"`
+	LabelWidth  float64 `json:"label_width"`
+	LabelHeight float64 `json:"label_height"`
+	MarginTop   float64 `json:"margin_top"`
+	MarginLeft  float64 `json:"margin_left"`
+	ColumnGap   float64 `json:"column_gap"`
+	RowGap      float64 `json:"row_gap"`
+}
+
+// PerPage is the number of labels on one sheet
+func (l Layout) PerPage() int {
+	return l.Columns * l.Rows
+}
+
+// position returns the top left corner of the label at index on its sheet
+func (l Layout) position(index int) (float64, float64) {
+	column := index % l.Columns
+	row := index / l.Columns
+
+	x := l.MarginLeft + float64(column)*(l.LabelWidth+l.ColumnGap)
+	y := l.MarginTop + float64(row)*(l.LabelHeight+l.RowGap)
+
+	return x, y
+}
+
+const (
+	a4Width      = 210.0
+	a4Height     = 297.0
+	letterWidth  = 215.9
+	letterHeight = 279.4
+)
+
+// Layouts are the supported label sheets, by name
+var Layouts = map[string]Layout{
+	"avery-l7160": {
+		Name:        "avery-l7160",
+		Description: "Avery L7160, A4, 21 labels of 63.5 x 38.1 mm",
+		PageWidth:   a4Width,
+		PageHeight:  a4Height,
+		Columns:     3,
+		Rows:        7,
+		LabelWidth:  63.5,
+		LabelHeight: 38.1,
+		MarginTop:   15.15,
+		MarginLeft:  7.25,
+		ColumnGap:   2.5,
+	},
+	"avery-l7163": {
+		Name:        "avery-l7163",
+		Description: "Avery L7163, A4, 14 labels of 99.1 x 38.1 mm",
+		PageWidth:   a4Width,
+		PageHeight:  a4Height,
+		Columns:     2,
+		Rows:        7,
+		LabelWidth:  99.1,
+		LabelHeight: 38.1,
+		MarginTop:   15.15,
+		MarginLeft:  4.65,
+		ColumnGap:   2.5,
+	},
+	"avery-l7165": {
+		Name:        "avery-l7165",
+		Description: "Avery L7165, A4, 8 labels of 99.1 x 67.7 mm",
+		PageWidth:   a4Width,
+		PageHeight:  a4Height,
+		Columns:     2,
+		Rows:        4,
+		LabelWidth:  99.1,
+		LabelHeight: 67.7,
+		MarginTop:   13.1,
+		MarginLeft:  4.65,
+		ColumnGap:   2.5,
+	},
+	"avery-5160": {
+		Name:        "avery-5160",
+		Description: "Avery 5160, US Letter, 30 labels of 2 5/8 x 1 in",
+		PageWidth:   letterWidth,
+		PageHeight:  letterHeight,
+		Columns:     3,
+		Rows:        10,
+		LabelWidth:  66.675,
+		LabelHeight: 25.4,
+		MarginTop:   12.7,
+		MarginLeft:  4.7625,
+		ColumnGap:   3.175,
+	},
+	"avery-5163": {
+		Name:        "avery-5163",
+		Description: "Avery 5163, US Letter, 10 labels of 4 x 2 in",
+		PageWidth:   letterWidth,
+		PageHeight:  letterHeight,
+		Columns:     2,
+		Rows:        5,
+		LabelWidth:  101.6,
+		LabelHeight: 50.8,
+		MarginTop:   12.7,
+		MarginLeft:  3.96875,
+		ColumnGap:   4.7625,
+	},
+}
+
+// FindLayout returns the layout with name, or DefaultLayout if name is empty
+func FindLayout(name string) (Layout, error) {
+	if name == "" {
+		name = DefaultLayout
+	}
+
+	layout, ok := Layouts[name]
+	if !ok {
+		return Layout{}, ErrUnknownLayout
+	}
+
+	return layout, nil
+}
+
+// LayoutNames returns the names of the supported layouts, sorted
+func LayoutNames() []string {
+	names := make([]string, 0, len(Layouts))
+	for name := range Layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
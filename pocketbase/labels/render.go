@@ -0,0 +1,189 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// ptToMM converts a font size in points to millimetres
+const ptToMM = 25.4 / 72
+
+// Label is a single sticker: a QR code with the book title and the
+// human-readable code next to it
+type Label struct {
+	// QR is the content encoded in the QR code
+	QR    string
+	Title string
+	Code  string
+	ISBN  string
+}
+
+// Render writes a PDF of labels laid out on layout's sheets. The first skip
+// positions of the first sheet are left empty so partly used sheets can be
+// printed on.
+func Render(w io.Writer, layout Layout, labels []Label, skip int) error {
+	if len(labels) == 0 {
+		return errors.New("labels: nothing to print")
+	}
+	if skip < 0 || skip >= layout.PerPage() {
+		return fmt.Errorf("labels: skip must be between 0 and %d", layout.PerPage()-1)
+	}
+
+	pdf := fpdf.NewCustom(&fpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           fpdf.SizeType{Wd: layout.PageWidth, Ht: layout.PageHeight},
+	})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetCreator("Massolit", true)
+	pdf.SetTitle("Book labels", true)
+
+	r := &renderer{pdf: pdf, layout: layout, tr: pdf.UnicodeTranslatorFromDescriptor("")}
+
+	for i, label := range labels {
+		index := (skip + i) % layout.PerPage()
+		if i == 0 || index == 0 {
+			pdf.AddPage()
+		}
+
+		x, y := layout.position(index)
+		if err := r.label(x, y, label); err != nil {
+			return fmt.Errorf("labels: error drawing %s: %v", label.Code, err)
+		}
+	}
+
+	return pdf.Output(w)
+}
+
+type renderer struct {
+	pdf    *fpdf.Fpdf
+	layout Layout
+	tr     func(string) string
+}
+
+// label draws a label with its top left corner at x, y: the QR code fills
+// the height on the left, the title runs down from the top on the right and
+// the code sits at the bottom.
+func (r *renderer) label(x float64, y float64, label Label) error {
+	w := r.layout.LabelWidth
+	h := r.layout.LabelHeight
+	padding := math.Min(3, h*0.08)
+
+	qrSize := math.Min(h-2*padding, w*0.4)
+	if err := r.qr(x+padding, y+(h-qrSize)/2, qrSize, label.QR); err != nil {
+		return err
+	}
+
+	textX := x + 2*padding + qrSize
+	textWidth := x + w - padding - textX
+
+	titleSize := math.Max(7, math.Min(11, h*0.2))
+	codeSize := titleSize + 2
+	isbnSize := titleSize - 1.5
+
+	// Bottom up: the code, the ISBN above it, then whatever is left for the title
+	bottom := y + h - padding - codeSize*ptToMM*0.2
+	r.pdf.SetFont("Helvetica", "B", codeSize)
+	r.pdf.Text(textX, bottom, r.fit(label.Code, textWidth))
+	bottom -= codeSize * ptToMM * 1.2
+
+	if label.ISBN != "" {
+		r.pdf.SetFont("Helvetica", "", isbnSize)
+		r.pdf.Text(textX, bottom, r.fit(label.ISBN, textWidth))
+		bottom -= isbnSize * ptToMM * 1.2
+	}
+
+	r.pdf.SetFont("Helvetica", "B", titleSize)
+	lineHeight := titleSize * ptToMM * 1.15
+	top := y + padding + titleSize*ptToMM*0.8
+	maxLines := max(1, int((bottom-top)/lineHeight)+1)
+	for i, line := range r.wrap(label.Title, textWidth, maxLines) {
+		r.pdf.Text(textX, top+float64(i)*lineHeight, line)
+	}
+
+	return r.pdf.Error()
+}
+
+// qr draws content as a QR code of size mm square, module by module so it
+// stays sharp at any printer resolution
+func (r *renderer) qr(x float64, y float64, size float64, content string) error {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+
+	bitmap := code.Bitmap()
+	module := size / float64(len(bitmap))
+
+	r.pdf.SetFillColor(0, 0, 0)
+	for row, modules := range bitmap {
+		// Runs of dark modules are drawn as one rectangle
+		for col := 0; col < len(modules); col++ {
+			if !modules[col] {
+				continue
+			}
+			start := col
+			for col+1 < len(modules) && modules[col+1] {
+				col++
+			}
+			r.pdf.Rect(x+float64(start)*module, y+float64(row)*module, float64(col-start+1)*module, module, "F")
+		}
+	}
+
+	return nil
+}
+
+// fit translates s for the current font and shortens it with an ellipsis
+// until it fits width
+func (r *renderer) fit(s string, width float64) string {
+	line := r.tr(s)
+	if r.pdf.GetStringWidth(line) <= width {
+		return line
+	}
+
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		line = r.tr(strings.TrimSpace(string(runes)) + "…")
+		if r.pdf.GetStringWidth(line) <= width {
+			return line
+		}
+	}
+
+	return ""
+}
+
+// wrap breaks s into at most maxLines lines of width using the current font.
+// The last line is shortened with an ellipsis if the text does not fit.
+func (r *renderer) wrap(s string, width float64, maxLines int) []string {
+	var lines []string
+	var current string
+
+	words := strings.Fields(s)
+	for i, word := range words {
+		candidate := strings.TrimSpace(current + " " + word)
+		if current == "" || r.pdf.GetStringWidth(r.tr(candidate)) <= width {
+			current = candidate
+			continue
+		}
+
+		if len(lines) == maxLines-1 {
+			return append(lines, r.fit(strings.Join(append([]string{current}, words[i:]...), " "), width))
+		}
+		lines = append(lines, r.fit(current, width))
+		current = word
+	}
+
+	if current != "" && len(lines) < maxLines {
+		lines = append(lines, r.fit(current, width))
+	}
+
+	return lines
+}
@@ -1,26 +1,33 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"embed"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"net/url"
+	"net/mail"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
 	"github.com/pocketbase/pocketbase/plugins/migratecmd"
-	"github.com/pocketbase/pocketbase/tools/cron"
 	_ "github.com/veritymedia/massolit/migrations"
+	"github.com/veritymedia/massolit/pocketbase/isbn"
+	"github.com/veritymedia/massolit/pocketbase/labels"
+	"github.com/veritymedia/massolit/pocketbase/managebac"
 	"github.com/veritymedia/massolit/pocketbase/tasks"
 )
 
@@ -34,18 +41,305 @@ type ConfigRecord struct {
 var public embed.FS
 
 // getDetentionSchedule reads the DETENTION_EMAIL_SCHEDULE environment variable
-// and returns it if set, otherwise returns the default schedule
+// and returns it if set to a valid cron expression, otherwise returns the
+// default schedule
 func getDetentionSchedule() string {
 	const defaultSchedule = "0 12 * * 1-5" // 12:00 PM Monday-Friday
 
-	schedule := os.Getenv("DETENTION_EMAIL_SCHEDULE")
+	schedule := strings.TrimSpace(os.Getenv("DETENTION_EMAIL_SCHEDULE"))
 	if schedule == "" {
 		return defaultSchedule
 	}
 
+	// A bad environment value must not stop the server from starting
+	if err := tasks.ValidateSchedule(schedule); err != nil {
+		fmt.Printf("ERROR: Invalid DETENTION_EMAIL_SCHEDULE '%s', using default %s\n", schedule, defaultSchedule)
+		return defaultSchedule
+	}
+
 	return schedule
 }
 
+// managebacErrorResponse passes ManageBac API errors through to the caller
+// with their original status code
+func managebacErrorResponse(c echo.Context, err error) error {
+	log.Printf("ManageBac request failed: %v", err)
+
+	var apiErr *managebac.APIError
+	if errors.As(err, &apiErr) {
+		return c.JSON(apiErr.StatusCode, map[string]string{"error": apiErr.Error()})
+	}
+
+	return c.JSON(http.StatusBadGateway, map[string]string{"error": "Failed to reach external server"})
+}
+
+// getDetentionReportMode reads the DETENTION_REPORT_MODE environment variable
+// ("today" or "outstanding") and returns it if valid, otherwise returns today
+func getDetentionReportMode() tasks.ReportMode {
+	switch mode := tasks.ReportMode(os.Getenv("DETENTION_REPORT_MODE")); mode {
+	case tasks.ReportModeToday, tasks.ReportModeOutstanding:
+		return mode
+	case "":
+		return tasks.ReportModeToday
+	default:
+		fmt.Printf("ERROR: Invalid DETENTION_REPORT_MODE '%s', using %s\n", mode, tasks.ReportModeToday)
+		return tasks.ReportModeToday
+	}
+}
+
+// getBehaviorSyncInterval reads the BEHAVIOR_SYNC_INTERVAL environment variable
+// (eg. "5m") and returns it if valid, otherwise returns the default interval
+func getBehaviorSyncInterval() time.Duration {
+	const defaultInterval = 5 * time.Minute
+
+	value := os.Getenv("BEHAVIOR_SYNC_INTERVAL")
+	if value == "" {
+		return defaultInterval
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		fmt.Printf("ERROR: Invalid BEHAVIOR_SYNC_INTERVAL '%s', using default %s\n", value, defaultInterval)
+		return defaultInterval
+	}
+
+	return interval
+}
+
+// getParentDetentionEmails reads the PARENT_DETENTION_EMAILS environment
+// variable and returns whether parents should be emailed about detentions
+func getParentDetentionEmails() bool {
+	value := os.Getenv("PARENT_DETENTION_EMAILS")
+	if value == "" {
+		return false
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		fmt.Printf("ERROR: Invalid PARENT_DETENTION_EMAILS '%s', parent emails are disabled\n", value)
+		return false
+	}
+
+	return enabled
+}
+
+// getGoogleBooksAPIKey reads the GOOGLE_BOOKS_API_KEY environment variable.
+// ISBN lookups work without a key, with lower rate limits.
+func getGoogleBooksAPIKey() string {
+	return os.Getenv("GOOGLE_BOOKS_API_KEY")
+}
+
+// getBehaviorReconcileLookback reads the BEHAVIOR_RECONCILE_LOOKBACK_DAYS
+// environment variable and returns how far back to check for notes deleted in
+// ManageBac, otherwise returns the default lookback
+func getBehaviorReconcileLookback() time.Duration {
+	const defaultDays = 30
+
+	value := os.Getenv("BEHAVIOR_RECONCILE_LOOKBACK_DAYS")
+	if value == "" {
+		return defaultDays * 24 * time.Hour
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days <= 0 {
+		fmt.Printf("ERROR: Invalid BEHAVIOR_RECONCILE_LOOKBACK_DAYS '%s', using default %d\n", value, defaultDays)
+		days = defaultDays
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// getDetentionReportCatchUpGrace reads the DETENTION_REPORT_CATCHUP_GRACE
+// environment variable (eg. "3h"), how long after its scheduled time a missed
+// report is still sent on startup. "0" disables catching up.
+func getDetentionReportCatchUpGrace() time.Duration {
+	const defaultGrace = 3 * time.Hour
+
+	value := os.Getenv("DETENTION_REPORT_CATCHUP_GRACE")
+	if value == "" {
+		return defaultGrace
+	}
+
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < 0 {
+		fmt.Printf("ERROR: Invalid DETENTION_REPORT_CATCHUP_GRACE '%s', using default %s\n", value, defaultGrace)
+		return defaultGrace
+	}
+
+	return grace
+}
+
+// validateScheduleConfig rejects config rows holding an invalid job schedule
+// or behaviour sync interval
+func validateScheduleConfig(scheduler *tasks.Scheduler, record *models.Record) error {
+	name := record.GetString("name")
+	if !scheduler.IsScheduleConfig(name) && name != tasks.BehaviorSyncIntervalConfigName {
+		return nil
+	}
+
+	// An empty value falls back to the default schedule or interval
+	value := record.GetString("value")
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	if name == tasks.BehaviorSyncIntervalConfigName {
+		if _, err := tasks.ValidateSyncInterval(value); err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		return nil
+	}
+
+	if err := tasks.ValidateSchedule(value); err != nil {
+		return apis.NewBadRequestError(err.Error(), nil)
+	}
+
+	return nil
+}
+
+// reloadScheduleConfig reschedules the jobs or the behaviour sync using a
+// changed config row
+func reloadScheduleConfig(scheduler *tasks.Scheduler, syncService *tasks.SyncService, model models.Model) {
+	record, ok := model.(*models.Record)
+	if !ok {
+		return
+	}
+
+	if record.GetString("name") == tasks.BehaviorSyncIntervalConfigName {
+		syncService.ReloadInterval()
+		return
+	}
+
+	scheduler.ReloadConfig(record.GetString("name"))
+}
+
+// validateRental checks a rental against the loan rules. Broken rules are
+// returned as field errors on the rentals record so the UI can show them.
+func validateRental(ctx context.Context, app *pocketbase.PocketBase, client *managebac.Client, record *models.Record) error {
+	err := tasks.ValidateRental(ctx, app, client, record)
+
+	var ruleErr *tasks.RentalRuleError
+	if errors.As(err, &ruleErr) {
+		return rentalRuleError(ruleErr)
+	}
+	if err != nil {
+		return apis.NewBadRequestError("Could not check the loan rules", err)
+	}
+
+	return nil
+}
+
+// readOnlyRentalFieldsError rejects a rentals request setting fields only the
+// server or an admin may set
+func readOnlyRentalFieldsError(fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	errs := validation.Errors{}
+	for _, field := range fields {
+		errs[field] = validation.NewError("validation_read_only", "This field is set by the server.")
+	}
+
+	return apis.NewBadRequestError("Only admins can change when a rental is due or returned", errs)
+}
+
+// rentalRuleError returns a broken loan rule as a field error
+func rentalRuleError(ruleErr *tasks.RentalRuleError) *apis.ApiError {
+	return apis.NewBadRequestError(ruleErr.Message, validation.Errors{
+		ruleErr.Field: validation.NewError(ruleErr.Code, ruleErr.Message),
+	})
+}
+
+// findLabelLayout returns the named label layout, checking that skip leaves
+// at least one label on its first sheet
+func findLabelLayout(name string, skip int) (labels.Layout, error) {
+	layout, err := labels.FindLayout(name)
+	if err != nil {
+		return labels.Layout{}, apis.NewBadRequestError("Unknown label layout", validation.Errors{
+			"layout": validation.NewError("validation_unknown_layout", "Must be one of "+strings.Join(labels.LayoutNames(), ", ")+"."),
+		})
+	}
+	if skip < 0 || skip >= layout.PerPage() {
+		message := fmt.Sprintf("Must be between 0 and %d.", layout.PerPage()-1)
+		return labels.Layout{}, apis.NewBadRequestError("Invalid number of labels to skip", validation.Errors{
+			"skip": validation.NewError("validation_invalid_skip", message),
+		})
+	}
+
+	return layout, nil
+}
+
+// requestISBN returns the isbn sent with a books request as it was typed.
+// books.isbn is a number field, which drops the leading zero of ISBN-10s.
+func requestISBN(c echo.Context, record *models.Record) string {
+	if value, ok := apis.RequestInfo(c).Data["isbn"].(string); ok {
+		return value
+	}
+
+	return record.GetString("isbn")
+}
+
+// isNotUniqueError reports whether data is a record validation error for a
+// field rejected by a unique index
+func isNotUniqueError(data any, field string) bool {
+	errs, ok := data.(validation.Errors)
+	if !ok {
+		return false
+	}
+
+	var fieldErr validation.Error
+	return errors.As(errs[field], &fieldErr) && fieldErr.Code() == "validation_not_unique"
+}
+
+// validateISBNOverride rejects isbn_overrides rows without a valid ISBN
+func validateISBNOverride(record *models.Record) error {
+	if err := tasks.NormalizeISBNOverride(record); err != nil {
+		return apis.NewBadRequestError("Invalid ISBN", validation.Errors{
+			"isbn13": validation.NewError("validation_invalid_isbn", "Must be a valid ISBN-10 or ISBN-13."),
+		})
+	}
+
+	return nil
+}
+
+// reportPreviewRequest selects the report to preview or test-send. grades and
+// categories are comma separated lists.
+type reportPreviewRequest struct {
+	Date            string `json:"date" query:"date"`
+	Mode            string `json:"mode" query:"mode"`
+	Period          string `json:"period" query:"period"`
+	Grades          string `json:"grades" query:"grades"`
+	HomeRoomAdvisor string `json:"homeroom_advisor" query:"homeroom_advisor"`
+	Categories      string `json:"categories" query:"categories"`
+	Format          string `json:"format" query:"format"`
+	Email           string `json:"email"`
+}
+
+// parse returns the report mode, day and scope of the request. The date
+// defaults to today and the mode to today's detentions.
+func (r reportPreviewRequest) parse() (tasks.ReportMode, time.Time, tasks.ReportScope, error) {
+	day := time.Now()
+	if r.Date != "" {
+		parsed, err := time.Parse("2006-01-02", r.Date)
+		if err != nil {
+			return "", day, tasks.ReportScope{}, fmt.Errorf("invalid date '%s', expected YYYY-MM-DD", r.Date)
+		}
+		day = parsed
+	}
+
+	mode := tasks.ReportMode(r.Mode)
+	switch mode {
+	case tasks.ReportModeToday, tasks.ReportModeOutstanding:
+	case "":
+		mode = tasks.ReportModeToday
+	default:
+		return "", day, tasks.ReportScope{}, fmt.Errorf("invalid mode '%s'", r.Mode)
+	}
+
+	return mode, day, tasks.ParseReportScope(r.Grades, r.HomeRoomAdvisor, r.Categories), nil
+}
+
 func main() {
 	app := pocketbase.New()
 
@@ -63,117 +357,289 @@ func main() {
 		fmt.Println("Warning: .env file not found, using environment variables from Docker")
 	}
 
-	managebacUrl := "https://api.managebac.com/v2"
 	managebacApiKey := os.Getenv("MANAGEBAC_API")
 
 	if len(managebacApiKey) == 0 {
 		log.Panic("No Managebac Key has been found. Exiting.")
 	}
 
-	app.OnBeforeServe().Add(func(e *core.ServeEvent) error {
-		scheduler := cron.New()
-		const defaultSchedule = "0 12 * * 1-5"
-
-		// Get detention email schedule from environment variable with fallback to default
-		detentionSchedule := getDetentionSchedule()
-		
-		// Log which schedule is being attempted
-		if detentionSchedule == defaultSchedule {
-			fmt.Printf("Using default detention email schedule: %s\n", defaultSchedule)
-		} else {
-			fmt.Printf("Using custom detention email schedule from environment: %s\n", detentionSchedule)
-		}
+	managebacClient := managebac.NewClient(
+		managebacApiKey,
+		managebac.WithBreaker(managebac.BreakerConfig{
+			FailureThreshold: managebac.DefaultBreakerConfig.FailureThreshold,
+			Cooldown:         managebac.DefaultBreakerConfig.Cooldown,
+			OnStateChange: func(status managebac.BreakerStatus) {
+				tasks.RecordManageBacStatus(app, status)
+			},
+		}),
+	)
+
+	scheduler := tasks.NewScheduler(app)
+
+	// Overrides are asked first, then Google Books, then Open Library
+	isbnResolver := tasks.NewISBNResolver(app,
+		isbn.NewGoogleBooks(getGoogleBooksAPIKey()),
+		isbn.NewOpenLibrary(),
+	)
+	detentionReportMode := getDetentionReportMode()
 
-		// Attempt to add the cron job with the provided schedule
-		err := scheduler.Add("sendDetentionReport", detentionSchedule, func() {
-			_ = tasks.HandleDetentionReportSend(app)
+	app.OnBeforeServe().Add(func(e *core.ServeEvent) error {
+		fmt.Printf("Using detention report mode: %s\n", detentionReportMode)
+
+		// The schedule is read from the detention_report_schedule config row,
+		// falling back to DETENTION_EMAIL_SCHEDULE or the built-in default
+		err := scheduler.Register(tasks.ScheduledJob{
+			ID:              "sendDetentionReport",
+			ConfigName:      tasks.DetentionReportScheduleConfigName,
+			DefaultSchedule: getDetentionSchedule(),
+			Run: func() {
+				_ = tasks.HandleDetentionReportSend(app, detentionReportMode, tasks.ReportTriggerScheduled)
+			},
 		})
-		
-		// If the cron expression is invalid, log error and fallback to default
 		if err != nil {
-			fmt.Printf("ERROR: Invalid cron expression '%s': %v\n", detentionSchedule, err)
-			fmt.Printf("Falling back to default detention email schedule: %s\n", defaultSchedule)
-			
-			// Attempt to add with default schedule
-			err = scheduler.Add("sendDetentionReport", defaultSchedule, func() {
-				_ = tasks.HandleDetentionReportSend(app)
+			return fmt.Errorf("failed to add detention report cron job: %v", err)
+		}
+
+		for _, summary := range []struct {
+			id         string
+			period     tasks.SummaryPeriod
+			configName string
+			schedule   string
+		}{
+			{"sendWeeklySummary", tasks.SummaryPeriodWeekly, tasks.WeeklySummaryScheduleConfigName, tasks.DefaultWeeklySummarySchedule},
+			{"sendTermlySummary", tasks.SummaryPeriodTermly, tasks.TermlySummaryScheduleConfigName, tasks.DefaultTermlySummarySchedule},
+		} {
+			period := summary.period
+			err := scheduler.Register(tasks.ScheduledJob{
+				ID:              summary.id,
+				ConfigName:      summary.configName,
+				DefaultSchedule: summary.schedule,
+				Run: func() {
+					_ = tasks.HandleSummaryReportSend(app, period, tasks.ReportTriggerScheduled)
+				},
 			})
 			if err != nil {
-				return fmt.Errorf("failed to add detention report cron job with default schedule: %v", err)
+				return fmt.Errorf("failed to add %s summary cron job: %v", period, err)
 			}
-			fmt.Printf("Successfully configured detention email with fallback schedule: %s\n", defaultSchedule)
-		} else {
-			fmt.Printf("Successfully configured detention email schedule: %s\n", detentionSchedule)
 		}
-		
+
+		err = scheduler.Register(tasks.ScheduledJob{
+			ID:              "sendAdvisorDigest",
+			ConfigName:      tasks.AdvisorDigestScheduleConfigName,
+			DefaultSchedule: tasks.DefaultAdvisorDigestSchedule,
+			Run: func() {
+				_ = tasks.HandleAdvisorDigestSend(context.Background(), app, managebacClient, tasks.ReportTriggerScheduled)
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add advisor digest cron job: %v", err)
+		}
+
+		err = scheduler.Register(tasks.ScheduledJob{
+			ID:              "sendOverdueReminders",
+			ConfigName:      tasks.OverdueReminderScheduleConfigName,
+			DefaultSchedule: tasks.DefaultOverdueReminderSchedule,
+			Run: func() {
+				_ = tasks.HandleOverdueReminders(context.Background(), app, managebacClient, tasks.ReportTriggerScheduled)
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add overdue reminder cron job: %v", err)
+		}
+
 		scheduler.Start()
+
+		// Send today's report if it was missed while the server was down
+		go func() {
+			if err := tasks.CatchUpDetentionReport(app, scheduler.Schedule("sendDetentionReport"), detentionReportMode, getDetentionReportCatchUpGrace()); err != nil {
+				log.Printf("Error catching up on detention report: %v", err)
+			}
+		}()
+
+		e.Router.GET("/scheduler/jobs", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, scheduler.Jobs())
+		}, apis.RequireAdminAuth())
+
+		return nil
+	})
+
+	syncService := tasks.NewSyncService(app, managebacClient, getBehaviorSyncInterval())
+	syncService.EnableReconciliation(24*time.Hour, getBehaviorReconcileLookback())
+	if getParentDetentionEmails() {
+		syncService.EnableParentNotifications()
+	}
+
+	// Reject invalid schedules when they are saved to the config collection
+	app.OnRecordBeforeCreateRequest("config").Add(func(e *core.RecordCreateEvent) error {
+		return validateScheduleConfig(scheduler, e.Record)
+	})
+
+	app.OnRecordBeforeUpdateRequest("config").Add(func(e *core.RecordUpdateEvent) error {
+		return validateScheduleConfig(scheduler, e.Record)
+	})
+
+	// Pick up schedule changes without a restart
+	app.OnModelAfterCreate("config").Add(func(e *core.ModelEvent) error {
+		reloadScheduleConfig(scheduler, syncService, e.Model)
+		return nil
+	})
+
+	app.OnModelAfterUpdate("config").Add(func(e *core.ModelEvent) error {
+		reloadScheduleConfig(scheduler, syncService, e.Model)
+		return nil
+	})
+
+	app.OnModelAfterDelete("config").Add(func(e *core.ModelEvent) error {
+		reloadScheduleConfig(scheduler, syncService, e.Model)
 		return nil
 	})
 
 	app.OnBeforeServe().Add(func(e *core.ServeEvent) error {
-		go func() {
-			for {
-				modifiedSinceRecord, err := e.App.Dao().FindRecordsByFilter("config", "name='last_behavior_sync_datetime'", "", 1, 0)
-
-				if err != nil {
-					fmt.Println("CRON::BEHAVIOUR_NOTES Error: Could not fetch latest edit time")
-					break
-				}
-
-				if len(modifiedSinceRecord) == 0 {
-					fmt.Println("CRON::BEHAVIOUR_NOTES Error: Could not fetch, length 0")
-					break
-				}
-
-				var modifiedSinceValue string = modifiedSinceRecord[0].GetString("value")
-
-				fmt.Printf("CRON::BEHAVIOUR_NOTES Last modified %s\n", modifiedSinceValue)
-
-				resp, err := tasks.FetchBehaviorNotes(managebacApiKey, modifiedSinceValue, managebacUrl)
-
-				if err != nil {
-					log.Printf("Error fetching behavior notes: %v", err)
-				} else {
-					fmt.Printf("CRON::BEHAVIOUR_NOTES Fetched %d behavior notes\n", len(resp.BehaviorNotes))
-
-					if err := tasks.SaveBehaviorNotes(app, resp.BehaviorNotes); err != nil {
-						log.Printf("Error saving behavior notes: %v", err)
-					}
-
-					// After saving behavior notes, check for new detentions in rolling 7-day window
-					detentionNotes, err := tasks.GetDetentionNotes(app)
-					if err != nil {
-						log.Printf("Error checking detention notes: %v", err)
-					} else if len(detentionNotes) > 0 {
-						fmt.Printf("CRON::BEHAVIOUR_NOTES Found %d pending detentions in 7-day window\n", len(detentionNotes))
-					}
-
-					// Check for double detentions (students with multiple detentions in 7-day window)
-					doubleDetentions, err := tasks.CheckDoubleDetentions(app)
-					if err != nil {
-						log.Printf("Error checking double detentions: %v", err)
-					} else if len(doubleDetentions) > 0 {
-						fmt.Printf("CRON::BEHAVIOUR_NOTES ALERT: Found %d students with multiple detentions in 7-day window\n", len(doubleDetentions))
-						for _, student := range doubleDetentions {
-							fmt.Printf("  - DOUBLE DETENTION: %s %s (%s) has %d detentions\n", 
-								student.FirstName, student.LastName, student.Grade, student.DetentionCount)
-						}
-					}
-
-					updatedSinceRecord := modifiedSinceRecord[0]
-					updatedSinceRecord.Set("value", time.Now().Format(time.RFC3339))
-
-					if err := app.Dao().SaveRecord(updatedSinceRecord); err != nil {
-						fmt.Printf("Could not save new modified_since param: %s", err)
-					}
-				}
-
-				time.Sleep(5 * time.Minute)
+		syncService.Start(context.Background())
+
+		e.Router.POST("/behavior/sync", func(c echo.Context) error {
+			result, err := syncService.RunManual()
+			if errors.Is(err, tasks.ErrSyncInProgress) {
+				return apis.NewApiError(http.StatusConflict, err.Error(), nil)
 			}
-		}()
+
+			// A failed run is still reported with its details rather than as an error
+			return c.JSON(http.StatusOK, result)
+		}, apis.RequireAdminAuth())
+
+		return nil
+	})
+
+	app.OnTerminate().Add(func(e *core.TerminateEvent) error {
+		scheduler.Stop()
+		syncService.Stop()
+		return nil
+	})
+
+	// Stamp escalations as they are acknowledged or resolved
+	app.OnRecordBeforeUpdateRequest("escalations").Add(func(e *core.RecordUpdateEvent) error {
+		tasks.UpdateEscalationTimestamps(e.Record, e.Record.OriginalCopy())
+		return nil
+	})
+
+	// Reject email template overrides that would break the emails
+	app.OnRecordBeforeCreateRequest("email_templates").Add(func(e *core.RecordCreateEvent) error {
+		if err := tasks.ValidateEmailTemplate(e.Record); err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		return nil
+	})
+
+	app.OnRecordBeforeUpdateRequest("email_templates").Add(func(e *core.RecordUpdateEvent) error {
+		if err := tasks.ValidateEmailTemplate(e.Record); err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
 		return nil
 	})
 
+	// Due dates, reminders and returns are only set by the server or an admin,
+	// so only admins can record a rental that has already been returned
+	app.OnRecordBeforeCreateRequest("rentals").Add(func(e *core.RecordCreateEvent) error {
+		if admin, _ := e.HttpContext.Get(apis.ContextAdminKey).(*models.Admin); admin != nil {
+			return nil
+		}
+		return readOnlyRentalFieldsError(tasks.PresetServerRentalFields(e.Record))
+	})
+
+	app.OnRecordBeforeUpdateRequest("rentals").Add(func(e *core.RecordUpdateEvent) error {
+		if admin, _ := e.HttpContext.Get(apis.ContextAdminKey).(*models.Admin); admin != nil {
+			return nil
+		}
+		return readOnlyRentalFieldsError(tasks.ChangedServerRentalFields(e.Record))
+	})
+
+	// Loan rules: one open rental per copy, a limit per student, no new loans
+	// while books are overdue and rented_to must be a ManageBac student.
+	// Returned rentals made by admins are loan history and are not checked.
+	app.OnRecordBeforeCreateRequest("rentals").Add(func(e *core.RecordCreateEvent) error {
+		if !e.Record.GetDateTime("returned_at").IsZero() {
+			return nil
+		}
+		return validateRental(e.HttpContext.Request().Context(), app, managebacClient, e.Record)
+	})
+
+	app.OnRecordBeforeUpdateRequest("rentals").Add(func(e *core.RecordUpdateEvent) error {
+		if !tasks.IsOpenRentalChange(e.Record) {
+			return nil
+		}
+		return validateRental(e.HttpContext.Request().Context(), app, managebacClient, e.Record)
+	})
+
+	// The open rental index catches a copy rented out twice at the same time,
+	// which is reported the same way as the loan rule
+	app.OnBeforeApiError().Add(func(e *core.ApiErrorEvent) error {
+		var apiErr *apis.ApiError
+		if !errors.As(e.Error, &apiErr) {
+			return nil
+		}
+
+		collection, _ := e.HttpContext.Get(apis.ContextCollectionKey).(*models.Collection)
+		if collection == nil || collection.Name != "rentals" {
+			return nil
+		}
+
+		if isNotUniqueError(apiErr.RawData(), "book_instance") {
+			*apiErr = *rentalRuleError(tasks.ErrCopyOnLoan)
+		}
+		return nil
+	})
+
+	// Rentals are due back after the loan period of the book or its department
+	app.OnRecordBeforeCreateRequest("rentals").Add(func(e *core.RecordCreateEvent) error {
+		dueAt, err := tasks.RentalDueDate(app, e.Record.GetString("book_instance"), time.Now())
+		if err != nil {
+			return apis.NewBadRequestError("Could not work out when the book is due back", err)
+		}
+		e.Record.Set("due_at", dueAt)
+
+		return nil
+	})
+
+	// Overrides can be entered as ISBN-10 or ISBN-13 and are stored as ISBN-13
+	app.OnRecordBeforeCreateRequest("isbn_overrides").Add(func(e *core.RecordCreateEvent) error {
+		return validateISBNOverride(e.Record)
+	})
+
+	app.OnRecordBeforeUpdateRequest("isbn_overrides").Add(func(e *core.RecordUpdateEvent) error {
+		return validateISBNOverride(e.Record)
+	})
+
+	// Books are stored with the ISBN-13 whichever form they were entered in
+	app.OnRecordBeforeCreateRequest("books").Add(func(e *core.RecordCreateEvent) error {
+		tasks.NormalizeBookISBN(e.Record, requestISBN(e.HttpContext, e.Record))
+		return nil
+	})
+
+	app.OnRecordBeforeUpdateRequest("books").Add(func(e *core.RecordUpdateEvent) error {
+		tasks.NormalizeBookISBN(e.Record, requestISBN(e.HttpContext, e.Record))
+		return nil
+	})
+
+	// Books get the cover cached for their ISBN instead of hotlinking one
+	app.OnRecordAfterCreateRequest("books").Add(func(e *core.RecordCreateEvent) error {
+		if err := isbnResolver.AttachBookCover(e.HttpContext.Request().Context(), e.Record); err != nil {
+			log.Printf("Error attaching cover to book %s: %v", e.Record.Id, err)
+		}
+		return nil
+	})
+
+	app.OnRecordAfterUpdateRequest("books").Add(func(e *core.RecordUpdateEvent) error {
+		if err := isbnResolver.AttachBookCover(e.HttpContext.Request().Context(), e.Record); err != nil {
+			log.Printf("Error attaching cover to book %s: %v", e.Record.Id, err)
+		}
+		return nil
+	})
+
+	// Rentals are kept as loan history, books are returned with POST /rentals/:id/return
+	app.OnRecordBeforeDeleteRequest("rentals").Add(func(e *core.RecordDeleteEvent) error {
+		return apis.NewForbiddenError("Rentals cannot be deleted, return the book instead", nil)
+	})
+
 	app.OnBeforeServe().Add(func(e *core.ServeEvent) error {
 
 		e.Router.GET("/homepage-stats", func(e echo.Context) error {
@@ -199,7 +665,7 @@ func main() {
 
 			var rentalsRecords []IdRecord
 
-			err = app.Dao().DB().Select("id").From("rentals").All(&rentalsRecords)
+			err = app.Dao().DB().Select("id").From("rentals").Where(dbx.NewExp("returned_at = ''")).All(&rentalsRecords)
 
 			if err != nil {
 				return fmt.Errorf("Error: %s", err.Error())
@@ -207,7 +673,7 @@ func main() {
 
 			var behaviorNotes []IdRecord
 
-			err = app.Dao().DB().Select("id").From("behavior_notes").Where(dbx.NewExp("action_complete = False", dbx.Params{})).All(&behaviorNotes)
+			err = app.Dao().DB().Select("id").From("behavior_notes").Where(dbx.NewExp("action_complete = False AND deleted_at = ''", dbx.Params{})).All(&behaviorNotes)
 
 			if err != nil {
 				fmt.Printf("Error: %s", err.Error())
@@ -239,103 +705,323 @@ func main() {
 			return nil
 		})
 
-		e.Router.GET("/managebac/students", func(c echo.Context) error {
+		e.Router.POST("/rentals/:id/return", func(c echo.Context) error {
+			var req struct {
+				Condition      string `json:"condition"`
+				ConditionNotes string `json:"condition_notes"`
+			}
+			if err := c.Bind(&req); err != nil {
+				return apis.NewBadRequestError("Invalid request", err)
+			}
 
-			searchParam := c.QueryParam("q")
-			resource := "/v2/students"
-			params := url.Values{}
-			params.Add("per_page", "400")
-			params.Add("q", searchParam)
+			record, err := tasks.ReturnRental(app, c.PathParam("id"), req.Condition, req.ConditionNotes)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return apis.NewNotFoundError("Rental not found", nil)
+			case errors.Is(err, tasks.ErrInvalidRentalCondition):
+				return apis.NewBadRequestError(err.Error(), nil)
+			case errors.Is(err, tasks.ErrRentalReturned):
+				return apis.NewApiError(http.StatusConflict, err.Error(), nil)
+			case err != nil:
+				log.Printf("Error returning rental: %v", err)
+				return apis.NewApiError(http.StatusInternalServerError, "Failed to return rental", nil)
+			}
 
-			u, _ := url.ParseRequestURI(managebacUrl)
-			u.Path = resource
-			u.RawQuery = params.Encode()
-			qualifiedUrl := fmt.Sprintf("%v", u)
-			req, err := http.NewRequest(http.MethodGet, qualifiedUrl, nil)
+			return c.JSON(http.StatusOK, record)
+		}, apis.RequireAdminOrRecordAuth())
 
-			fmt.Println("URL: ", qualifiedUrl)
+		e.Router.GET("/book-instances/:id/rentals", func(c echo.Context) error {
+			history, err := tasks.GetCopyLoanHistory(app, c.PathParam("id"))
+			if err != nil {
+				log.Printf("Error loading loan history: %v", err)
+				return apis.NewApiError(http.StatusInternalServerError, "Failed to load loan history", nil)
+			}
 
+			return c.JSON(http.StatusOK, history)
+		}, apis.RequireAdminOrRecordAuth())
+
+		e.Router.GET("/students/:studentId/rentals", func(c echo.Context) error {
+			history, err := tasks.GetStudentLoanHistory(app, c.PathParam("studentId"))
 			if err != nil {
-				fmt.Println(err)
-				c.JSON(500, map[string]string{
-					"message": "Could not create request",
+				log.Printf("Error loading loan history: %v", err)
+				return apis.NewApiError(http.StatusInternalServerError, "Failed to load loan history", nil)
+			}
+
+			return c.JSON(http.StatusOK, history)
+		}, apis.RequireAdminOrRecordAuth())
+
+		e.Router.GET("/isbn/:isbn", func(c echo.Context) error {
+			refresh, _ := strconv.ParseBool(c.QueryParam("refresh"))
+
+			lookup, err := isbnResolver.Lookup(c.Request().Context(), c.PathParam("isbn"), refresh)
+			switch {
+			case errors.Is(err, isbn.ErrInvalid):
+				return apis.NewBadRequestError("Invalid ISBN", validation.Errors{
+					"isbn": validation.NewError("validation_invalid_isbn", "Must be a valid ISBN-10 or ISBN-13."),
 				})
+			case errors.Is(err, isbn.ErrNotFound):
+				return apis.NewNotFoundError("No book found for this ISBN", nil)
+			case err != nil:
+				log.Printf("Error looking up ISBN: %v", err)
+				return apis.NewApiError(http.StatusBadGateway, "Could not reach the ISBN providers", nil)
 			}
 
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("auth-token", managebacApiKey)
+			return c.JSON(http.StatusOK, lookup)
+		}, apis.RequireAdminOrRecordAuth())
 
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				// Handle the error if the request fails
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reach external server"})
+		e.Router.POST("/books/:id/labels", func(c echo.Context) error {
+			var req struct {
+				Copies int    `json:"copies"`
+				Prefix string `json:"prefix"`
+				Layout string `json:"layout"`
+				Skip   int    `json:"skip"`
+			}
+			if err := c.Bind(&req); err != nil {
+				return apis.NewBadRequestError("Invalid request", err)
 			}
-			defer resp.Body.Close()
 
-			body, err := ioutil.ReadAll(resp.Body)
+			book, err := app.Dao().FindRecordById("books", c.PathParam("id"))
 			if err != nil {
-				// Handle error reading the body
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read response"})
+				return apis.NewNotFoundError("Book not found", nil)
 			}
 
-			var jsonResponse map[string]interface{}
-			if err := json.Unmarshal(body, &jsonResponse); err != nil {
-				// Handle the case where the response is not valid JSON
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Invalid JSON response from server"})
+			layout, err := findLabelLayout(req.Layout, req.Skip)
+			if err != nil {
+				return err
+			}
+			if req.Copies < 1 || req.Copies > tasks.MaxLabelCopies {
+				message := fmt.Sprintf("Must be between 1 and %d.", tasks.MaxLabelCopies)
+				return apis.NewBadRequestError("Invalid number of copies", validation.Errors{
+					"copies": validation.NewError("validation_invalid_copies", message),
+				})
 			}
 
-			// Log the external response for debugging (optional)
-			log.Printf("Response from external API: %v", jsonResponse)
+			prefix, err := tasks.BookCodePrefix(book, req.Prefix)
+			if err != nil {
+				return apis.NewBadRequestError("Invalid book code prefix", validation.Errors{
+					"prefix": validation.NewError("validation_invalid_prefix", "Must be letters, digits and hyphens, eg. IG-PSYCH."),
+				})
+			}
 
-			// Return the decoded JSON as a response
-			return c.JSON(resp.StatusCode, jsonResponse)
-		})
+			// The labels are rendered before the instances are committed, so a
+			// failed render does not leave instances without labels
+			var pdf bytes.Buffer
+			instances, err := tasks.CreateBookInstances(app, book, prefix, req.Copies, func(created []*models.Record) error {
+				return labels.Render(&pdf, layout, tasks.BookLabels(book, created), req.Skip)
+			})
+			if err != nil {
+				log.Printf("Error creating book instances: %v", err)
+				return apis.NewApiError(http.StatusInternalServerError, "Failed to create book instances", nil)
+			}
 
-		e.Router.GET("/managebac/students/:studentId", func(c echo.Context) error {
+			filename := fmt.Sprintf("labels-%s-%s.pdf", instances[0].GetString("book_code"), instances[len(instances)-1].GetString("book_code"))
+			c.Response().Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
 
-			studentId := c.PathParam("studentId")
+			return c.Blob(http.StatusCreated, "application/pdf", pdf.Bytes())
+		}, apis.RequireAdminOrRecordAuth())
 
-			req, err := http.NewRequest(http.MethodGet, fmt.Sprint(managebacUrl, "/students/", studentId), nil)
+		e.Router.POST("/book-instances/labels", func(c echo.Context) error {
+			var req struct {
+				IDs    []string `json:"ids"`
+				Layout string   `json:"layout"`
+				Skip   int      `json:"skip"`
+			}
+			if err := c.Bind(&req); err != nil {
+				return apis.NewBadRequestError("Invalid request", err)
+			}
 
+			layout, err := findLabelLayout(req.Layout, req.Skip)
 			if err != nil {
-				fmt.Println(err)
-				c.JSON(500, map[string]string{
-					"message": "Could not create request",
+				return err
+			}
+			if len(req.IDs) < 1 || len(req.IDs) > tasks.MaxLabelCopies {
+				message := fmt.Sprintf("Must be between 1 and %d book instances.", tasks.MaxLabelCopies)
+				return apis.NewBadRequestError("Invalid number of book instances", validation.Errors{
+					"ids": validation.NewError("validation_invalid_ids", message),
 				})
 			}
 
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("auth-token", managebacApiKey)
+			bookLabels, err := tasks.BookInstanceLabels(app, req.IDs)
+			if errors.Is(err, tasks.ErrBookInstanceNotFound) {
+				return apis.NewNotFoundError(err.Error(), nil)
+			}
+			if err != nil {
+				log.Printf("Error loading book instance labels: %v", err)
+				return apis.NewApiError(http.StatusInternalServerError, "Failed to load book instances", nil)
+			}
+
+			var pdf bytes.Buffer
+			if err := labels.Render(&pdf, layout, bookLabels, req.Skip); err != nil {
+				log.Printf("Error rendering labels: %v", err)
+				return apis.NewApiError(http.StatusInternalServerError, "Failed to render labels", nil)
+			}
+
+			filename := fmt.Sprintf("labels-%s-%s.pdf", bookLabels[0].Code, bookLabels[len(bookLabels)-1].Code)
+			c.Response().Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+			return c.Blob(http.StatusOK, "application/pdf", pdf.Bytes())
+		}, apis.RequireAdminOrRecordAuth())
+
+		e.Router.GET("/behavior/report/preview", func(c echo.Context) error {
+			var req reportPreviewRequest
+			if err := c.Bind(&req); err != nil {
+				return apis.NewBadRequestError("Invalid request", err)
+			}
+
+			mode, day, scope, err := req.parse()
+			if err != nil {
+				return apis.NewBadRequestError(err.Error(), nil)
+			}
+
+			htmlBody, textBody, err := tasks.PreviewDetentionReport(app, mode, day, scope)
+			if err != nil {
+				log.Printf("Error previewing detention report: %v", err)
+				return apis.NewApiError(http.StatusInternalServerError, "Failed to render detention report", nil)
+			}
+
+			if req.Format == "text" {
+				return c.String(http.StatusOK, textBody)
+			}
+
+			return c.HTML(http.StatusOK, htmlBody)
+		}, apis.RequireAdminAuth())
+
+		e.Router.GET("/behavior/summary/preview", func(c echo.Context) error {
+			var req reportPreviewRequest
+			if err := c.Bind(&req); err != nil {
+				return apis.NewBadRequestError("Invalid request", err)
+			}
+
+			_, day, scope, err := req.parse()
+			if err != nil {
+				return apis.NewBadRequestError(err.Error(), nil)
+			}
+
+			period := tasks.SummaryPeriod(req.Period)
+			switch period {
+			case tasks.SummaryPeriodWeekly, tasks.SummaryPeriodTermly:
+			case "":
+				period = tasks.SummaryPeriodWeekly
+			default:
+				return apis.NewBadRequestError(fmt.Sprintf("invalid period '%s'", req.Period), nil)
+			}
+
+			htmlBody, textBody, err := tasks.PreviewSummaryReport(app, period, day, scope)
+			if errors.Is(err, sql.ErrNoRows) {
+				return apis.NewBadRequestError("The date is not within a term", nil)
+			}
+			if err != nil {
+				log.Printf("Error previewing behaviour summary: %v", err)
+				return apis.NewApiError(http.StatusInternalServerError, "Failed to render behaviour summary", nil)
+			}
+
+			if req.Format == "text" {
+				return c.String(http.StatusOK, textBody)
+			}
+
+			return c.HTML(http.StatusOK, htmlBody)
+		}, apis.RequireAdminAuth())
+
+		e.Router.POST("/behavior/report/test-send", func(c echo.Context) error {
+			var req reportPreviewRequest
+			if err := c.Bind(&req); err != nil {
+				return apis.NewBadRequestError("Invalid request", err)
+			}
+
+			if _, err := mail.ParseAddress(req.Email); err != nil {
+				return apis.NewBadRequestError("A valid email is required", nil)
+			}
+
+			mode, day, scope, err := req.parse()
+			if err != nil {
+				return apis.NewBadRequestError(err.Error(), nil)
+			}
+
+			if err := tasks.SendTestDetentionReport(app, req.Email, mode, day, scope); err != nil {
+				log.Printf("Error sending test detention report: %v", err)
+				return apis.NewApiError(http.StatusInternalServerError, "Failed to send detention report", nil)
+			}
+
+			return c.NoContent(http.StatusNoContent)
+		}, apis.RequireAdminAuth())
+
+		e.Router.POST("/email-log/:id/resend", func(c echo.Context) error {
+			err := tasks.ResendFailedEmail(app, c.PathParam("id"))
+			if errors.Is(err, sql.ErrNoRows) {
+				return apis.NewNotFoundError("", nil)
+			}
+			if errors.Is(err, tasks.ErrEmailNotFailed) || errors.Is(err, tasks.ErrEmailAlreadyResent) {
+				return apis.NewApiError(http.StatusConflict, err.Error(), nil)
+			}
+			if err != nil {
+				log.Printf("Error re-sending email: %v", err)
+				return apis.NewApiError(http.StatusBadGateway, "Failed to re-send email", nil)
+			}
 
-			fmt.Println("API KEY: ", managebacApiKey)
+			return c.NoContent(http.StatusNoContent)
+		}, apis.RequireAdminAuth())
+
+		// Import terms, holidays and INSET days from an ICS file uploaded as
+		// "file". "type" sets the type of every event, or is "auto" to guess it
+		// from each event's summary.
+		e.Router.POST("/school-calendar/import", func(c echo.Context) error {
+			calendarType := c.FormValue("type")
+			switch calendarType {
+			case tasks.CalendarTypeTerm, tasks.CalendarTypeHoliday, tasks.CalendarTypeInset, tasks.CalendarTypeAuto:
+			case "":
+				calendarType = tasks.CalendarTypeAuto
+			default:
+				return apis.NewBadRequestError(fmt.Sprintf("Invalid type '%s'", calendarType), nil)
+			}
+
+			fileHeader, err := c.FormFile("file")
+			if err != nil {
+				return apis.NewBadRequestError("An ICS file is required", err)
+			}
 
-			client := &http.Client{}
-			resp, err := client.Do(req)
+			file, err := fileHeader.Open()
 			if err != nil {
-				// Handle the error if the request fails
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reach external server"})
+				return apis.NewBadRequestError("Could not read the uploaded file", err)
 			}
-			defer resp.Body.Close()
+			defer file.Close()
 
-			body, err := ioutil.ReadAll(resp.Body)
+			events, err := tasks.ParseICS(file)
 			if err != nil {
-				// Handle error reading the body
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read response"})
+				return apis.NewBadRequestError(fmt.Sprintf("Invalid ICS file: %v", err), nil)
 			}
 
-			var jsonResponse map[string]interface{}
-			if err := json.Unmarshal(body, &jsonResponse); err != nil {
-				// Handle the case where the response is not valid JSON
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Invalid JSON response from server"})
+			result, err := tasks.ImportCalendarEvents(app, events, calendarType)
+			if err != nil {
+				log.Printf("Error importing school calendar: %v", err)
+				return apis.NewApiError(http.StatusInternalServerError, "Failed to import calendar", nil)
 			}
 
-			// Log the external response for debugging (optional)
-			log.Printf("Response from external API: %s", body)
+			return c.JSON(http.StatusOK, result)
+		}, apis.RequireAdminAuth())
+
+		e.Router.GET("/managebac/students", func(c echo.Context) error {
+			students, err := managebacClient.ListStudents(c.Request().Context(), managebac.StudentListOptions{
+				ListOptions: managebac.ListOptions{PerPage: 400},
+				Query:       c.QueryParam("q"),
+			})
+			if err != nil {
+				return managebacErrorResponse(c, err)
+			}
+
+			return c.JSON(http.StatusOK, students)
+		})
+
+		e.Router.GET("/managebac/status", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, managebacClient.Status())
+		}, apis.RequireAdminAuth())
+
+		e.Router.GET("/managebac/students/:studentId", func(c echo.Context) error {
+			student, err := managebacClient.GetStudent(c.Request().Context(), c.PathParam("studentId"))
+			if err != nil {
+				return managebacErrorResponse(c, err)
+			}
 
-			// Return the response from the external server
-			// Return the decoded JSON as a response
-			return c.JSON(resp.StatusCode, jsonResponse)
+			return c.JSON(http.StatusOK, map[string]any{"student": student})
 		})
 
 		e.Router.GET("/*", apis.StaticDirectoryHandler(echo.MustSubFS(public, ".output/public"), true))
@@ -0,0 +1,55 @@
+package managebac
+
+import "context"
+
+// BehaviorNote represents the structure of behavior notes from ManageBac
+type BehaviorNote struct {
+	ID                int    `json:"id"`
+	StudentID         string `json:"student_id"`
+	FirstName         string `json:"first_name"`
+	LastName          string `json:"last_name"`
+	Email             string `json:"email"`
+	Grade             string `json:"grade"`
+	IncidentTime      string `json:"incident_time"`
+	BehaviorType      string `json:"behavior_type"`
+	Notes             string `json:"notes"`
+	NextStep          string `json:"next_step"`
+	NextStepDate      string `json:"next_step_date"`
+	AuthorID          int    `json:"author_id"`
+	ReportedBy        string `json:"reported_by"`
+	HomeRoomAdvisor   string `json:"homeroom_advisor"`
+	VisibleToParents  bool   `json:"visible_to_parents"`
+	VisibleToStudents bool   `json:"visible_to_students"`
+	CreatedAt         string `json:"created_at"`
+	UpdatedAt         string `json:"updated_at"`
+	ActionComplete    bool   `json:"action_complete"`
+}
+
+// BehaviorNotesResponse is a page of behavior notes
+type BehaviorNotesResponse struct {
+	BehaviorNotes []BehaviorNote `json:"behavior_notes"`
+	Meta          Meta           `json:"meta"`
+}
+
+// BehaviorNoteListOptions filters the behavior note list
+type BehaviorNoteListOptions struct {
+	ListOptions
+	// ModifiedSince limits results to notes created or edited after this
+	// RFC3339 timestamp
+	ModifiedSince string
+}
+
+// ListBehaviorNotes returns a single page of behavior notes matching opts
+func (c *Client) ListBehaviorNotes(ctx context.Context, opts BehaviorNoteListOptions) (*BehaviorNotesResponse, error) {
+	params := opts.values()
+	if opts.ModifiedSince != "" {
+		params.Set("modified_since", opts.ModifiedSince)
+	}
+
+	var resp BehaviorNotesResponse
+	if err := c.get(ctx, "/behavior/notes", params, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,167 @@
+package managebac
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting ManageBac while the circuit
+// breaker is open after repeated failures
+var ErrCircuitOpen = errors.New("managebac: circuit breaker open, ManageBac is unavailable")
+
+// BreakerState is the state of the client's circuit breaker
+type BreakerState string
+
+const (
+	// BreakerClosed means requests flow normally
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen means requests fail fast until the cooldown has passed
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen means the cooldown has passed and a single trial request
+	// is let through, others fail fast until it resolves
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// BreakerStatus is a snapshot of the circuit breaker
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+	LastError           string       `json:"last_error,omitempty"`
+	UpdatedAt           time.Time    `json:"updated_at"`
+}
+
+// BreakerConfig controls when the circuit breaker opens
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed requests that
+	// opens the breaker
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before allowing a trial request
+	Cooldown time.Duration
+	// OnStateChange is called whenever the breaker changes state
+	OnStateChange func(BreakerStatus)
+}
+
+// DefaultBreakerConfig is used unless overridden with WithBreaker
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 5,
+	Cooldown:         5 * time.Minute,
+}
+
+// WithBreaker overrides the circuit breaker configuration
+func WithBreaker(config BreakerConfig) Option {
+	return func(c *Client) {
+		c.breaker = newCircuitBreaker(config)
+	}
+}
+
+type circuitBreaker struct {
+	mu     sync.Mutex
+	config BreakerConfig
+	status BreakerStatus
+	// trial is set while the half-open trial request is in flight
+	trial bool
+}
+
+func newCircuitBreaker(config BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{
+		config: config,
+		status: BreakerStatus{State: BreakerClosed, UpdatedAt: time.Now()},
+	}
+}
+
+// allow returns ErrCircuitOpen while the breaker is open and the cooldown
+// has not yet passed, or while the half-open trial request is in flight.
+// trial is true for the request admitted as the trial, which must call
+// endTrial once it has resolved.
+func (b *circuitBreaker) allow() (trial bool, err error) {
+	b.mu.Lock()
+
+	switch b.status.State {
+	case BreakerClosed:
+		b.mu.Unlock()
+		return false, nil
+	case BreakerHalfOpen:
+		defer b.mu.Unlock()
+		if b.trial {
+			return false, ErrCircuitOpen
+		}
+		b.trial = true
+		return true, nil
+	}
+
+	if b.status.OpenedAt != nil && time.Since(*b.status.OpenedAt) < b.config.Cooldown {
+		b.mu.Unlock()
+		return false, ErrCircuitOpen
+	}
+
+	b.status.State = BreakerHalfOpen
+	b.status.UpdatedAt = time.Now()
+	b.trial = true
+	status := b.status
+	b.mu.Unlock()
+
+	b.notify(status)
+	return true, nil
+}
+
+// endTrial lets the next request through as a trial if the previous one
+// resolved without closing or opening the breaker, eg. it was cancelled
+func (b *circuitBreaker) endTrial() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// success closes the breaker
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+
+	changed := b.status.State != BreakerClosed
+	b.status = BreakerStatus{State: BreakerClosed, UpdatedAt: time.Now()}
+	status := b.status
+	b.mu.Unlock()
+
+	if changed {
+		b.notify(status)
+	}
+}
+
+// failure records a failed request and opens the breaker once the threshold
+// is reached, or immediately if the failure was a half-open trial
+func (b *circuitBreaker) failure(err error) {
+	b.mu.Lock()
+
+	b.status.ConsecutiveFailures++
+	b.status.LastError = err.Error()
+	b.status.UpdatedAt = time.Now()
+
+	changed := false
+	if b.status.State == BreakerHalfOpen || (b.status.State == BreakerClosed && b.status.ConsecutiveFailures >= b.config.FailureThreshold) {
+		openedAt := time.Now()
+		b.status.State = BreakerOpen
+		b.status.OpenedAt = &openedAt
+		changed = true
+	}
+	status := b.status
+	b.mu.Unlock()
+
+	if changed {
+		b.notify(status)
+	}
+}
+
+func (b *circuitBreaker) snapshot() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.status
+}
+
+func (b *circuitBreaker) notify(status BreakerStatus) {
+	if b.config.OnStateChange != nil {
+		b.config.OnStateChange(status)
+	}
+}
@@ -0,0 +1,206 @@
+// Package managebac is a small typed client for the ManageBac v2 API.
+package managebac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the ManageBac v2 API root
+	DefaultBaseURL = "https://api.managebac.com/v2"
+
+	// DefaultTimeout bounds every request made by the client
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultUserAgent is sent with every request unless overridden
+	DefaultUserAgent = "massolit"
+)
+
+// Client talks to the ManageBac API using a school auth token
+type Client struct {
+	baseURL    string
+	authToken  string
+	userAgent  string
+	httpClient *http.Client
+	retry      RetryPolicy
+	breaker    *circuitBreaker
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithBaseURL overrides the API root, eg. to point the client at a test server
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithTimeout sets the timeout applied to every request
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithHTTPClient replaces the underlying http.Client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient creates a ManageBac client authenticated with authToken
+func NewClient(authToken string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    DefaultBaseURL,
+		authToken:  authToken,
+		userAgent:  DefaultUserAgent,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		retry:      DefaultRetryPolicy,
+		breaker:    newCircuitBreaker(DefaultBreakerConfig),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Status returns the current state of the client's circuit breaker
+func (c *Client) Status() BreakerStatus {
+	return c.breaker.snapshot()
+}
+
+// get performs a GET request against resource and decodes the JSON response
+// into out. Transient failures are retried with backoff and feed the circuit
+// breaker.
+func (c *Client) get(ctx context.Context, resource string, params url.Values, out any) error {
+	trial, err := c.breaker.allow()
+	if err != nil {
+		return err
+	}
+	if trial {
+		defer c.breaker.endTrial()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = c.doGet(ctx, resource, params, out)
+		if !isRetryable(err) || attempt >= c.retry.MaxAttempts {
+			break
+		}
+
+		delay, ok := c.retry.backoff(attempt, err)
+		if !ok {
+			break
+		}
+
+		log.Printf("managebac: GET %s failed (attempt %d/%d), retrying in %s: %v",
+			resource, attempt, c.retry.MaxAttempts, delay.Round(time.Millisecond), err)
+
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return sleepErr
+		}
+	}
+
+	// A response that cannot be decoded is not recorded either way, so a
+	// change to the API does not open the breaker for every endpoint
+	switch {
+	case isRetryable(err):
+		c.breaker.failure(err)
+	case err == nil || errors.As(err, new(*APIError)):
+		// Any response from ManageBac, even a 4xx, shows the API is reachable
+		c.breaker.success()
+	}
+
+	return err
+}
+
+// doGet performs a single GET request
+func (c *Client) doGet(ctx context.Context, resource string, params url.Values, out any) error {
+	u, err := url.Parse(c.baseURL + resource)
+	if err != nil {
+		return fmt.Errorf("managebac: invalid url: %w", err)
+	}
+	if len(params) > 0 {
+		u.RawQuery = params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("managebac: error creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("auth-token", c.authToken)
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("managebac: error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: error decoding response: %w", ErrInvalidResponse, err)
+	}
+
+	return nil
+}
+
+// drain reads up to limit bytes of body, used to keep error messages short
+func drain(body io.Reader, limit int64) string {
+	b, _ := io.ReadAll(io.LimitReader(body, limit))
+	return strings.TrimSpace(string(b))
+}
+
+// Meta is the pagination block returned by list endpoints
+type Meta struct {
+	CurrentPage int `json:"current_page"`
+	TotalPages  int `json:"total_pages"`
+	TotalCount  int `json:"total_count"`
+	PerPage     int `json:"per_page"`
+}
+
+// HasNextPage reports whether another page follows this one
+func (m Meta) HasNextPage() bool {
+	return m.CurrentPage < m.TotalPages
+}
+
+// ListOptions are the pagination parameters shared by list endpoints
+type ListOptions struct {
+	Page    int
+	PerPage int
+}
+
+func (o ListOptions) values() url.Values {
+	params := url.Values{}
+	if o.Page > 0 {
+		params.Set("page", fmt.Sprint(o.Page))
+	}
+	if o.PerPage > 0 {
+		params.Set("per_page", fmt.Sprint(o.PerPage))
+	}
+	return params
+}
@@ -0,0 +1,330 @@
+package managebac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testRetryPolicy retries quickly so tests do not wait on the real backoff
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:   3,
+	BaseDelay:     time.Millisecond,
+	MaxDelay:      5 * time.Millisecond,
+	MaxRetryAfter: 2 * time.Second,
+}
+
+// newTestClient returns a client for a test server running handler, and a
+// counter of the requests the server received
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...Option) (*Client, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	opts = append([]Option{WithBaseURL(srv.URL), WithRetryPolicy(testRetryPolicy)}, opts...)
+
+	return NewClient("token", opts...), &requests
+}
+
+func TestAPIErrors(t *testing.T) {
+	tests := []struct {
+		status   int
+		want     error
+		attempts int32
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized, 1},
+		{http.StatusForbidden, ErrForbidden, 1},
+		{http.StatusNotFound, ErrNotFound, 1},
+		{http.StatusTooManyRequests, ErrRateLimited, 3},
+		{http.StatusInternalServerError, ErrServer, 3},
+		{http.StatusBadGateway, ErrServer, 3},
+		{http.StatusServiceUnavailable, ErrServer, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "nope", tt.status)
+			})
+
+			_, err := client.ListTeachers(context.Background(), ListOptions{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Fatalf("got error %#v, want an *APIError with status %d", err, tt.status)
+			}
+
+			if got := requests.Load(); got != tt.attempts {
+				t.Errorf("got %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("auth-token"); got != "token" {
+			t.Errorf("got auth-token %q, want %q", got, "token")
+		}
+		fmt.Fprint(w, `{"teachers":[],"meta":{"current_page":1,"total_pages":1}}`)
+	})
+
+	if _, err := client.ListTeachers(context.Background(), ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListAllTeachersPagination(t *testing.T) {
+	client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		fmt.Fprintf(w, `{"teachers":[{"id":%d},{"id":%d}],"meta":{"current_page":%d,"total_pages":3}}`, page*10, page*10+1, page)
+	})
+
+	teachers, err := client.ListAllTeachers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want one per page", got)
+	}
+
+	want := []int{10, 11, 20, 21, 30, 31}
+	if len(teachers) != len(want) {
+		t.Fatalf("got %d teachers, want %d", len(teachers), len(want))
+	}
+	for i, teacher := range teachers {
+		if teacher.ID != want[i] {
+			t.Errorf("teacher %d has id %d, want %d", i, teacher.ID, want[i])
+		}
+	}
+}
+
+func TestListAllTeachersStopsOnEmptyPage(t *testing.T) {
+	client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"teachers":[],"meta":{"current_page":1,"total_pages":5}}`)
+	})
+
+	if _, err := client.ListAllTeachers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxRetryAfter: 2 * time.Second}))
+
+	start := time.Now()
+	_, err := client.ListTeachers(context.Background(), ListOptions{})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("got error %v, want ErrRateLimited", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want the 1s Retry-After", elapsed)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("got %d attempts, want 2", got)
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, err := client.ListTeachers(context.Background(), ListOptions{})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != time.Hour {
+		t.Fatalf("got error %v, want an *APIError with a RetryAfter of 1h", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("got %d attempts, want no retry past MaxRetryAfter", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	}
+
+	for _, tt := range tests {
+		got := parseRetryAfter(tt.value)
+		if got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}, WithBreaker(BreakerConfig{FailureThreshold: 2, Cooldown: time.Hour}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.ListTeachers(context.Background(), ListOptions{}); !errors.Is(err, ErrServer) {
+			t.Fatalf("request %d: got error %v, want ErrServer", i, err)
+		}
+	}
+
+	status := client.Status()
+	if status.State != BreakerOpen || status.OpenedAt == nil || status.ConsecutiveFailures != 2 {
+		t.Fatalf("got status %+v, want the breaker open after 2 failures", status)
+	}
+
+	before := requests.Load()
+	if _, err := client.ListTeachers(context.Background(), ListOptions{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got error %v, want ErrCircuitOpen", err)
+	}
+	if requests.Load() != before {
+		t.Error("open breaker let a request through")
+	}
+}
+
+func TestBreakerClientErrorsDoNotOpen(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}, WithBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour}))
+
+	for i := 0; i < 3; i++ {
+		client.ListTeachers(context.Background(), ListOptions{})
+	}
+
+	if status := client.Status(); status.State != BreakerClosed {
+		t.Errorf("got state %s after 404s, want closed", status.State)
+	}
+}
+
+func TestBreakerHalfOpenSingleTrial(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	release := make(chan struct{})
+
+	client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		<-release
+		fmt.Fprint(w, `{"teachers":[],"meta":{"current_page":1,"total_pages":1}}`)
+	}, WithBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: 20 * time.Millisecond}))
+
+	if _, err := client.ListTeachers(context.Background(), ListOptions{}); !errors.Is(err, ErrServer) {
+		t.Fatalf("got error %v, want ErrServer", err)
+	}
+	if state := client.Status().State; state != BreakerOpen {
+		t.Fatalf("got state %s, want open", state)
+	}
+
+	failing.Store(false)
+	time.Sleep(30 * time.Millisecond)
+
+	// The first request after the cooldown is the trial and blocks in the
+	// handler until released
+	trialDone := make(chan error, 1)
+	go func() {
+		_, err := client.ListTeachers(context.Background(), ListOptions{})
+		trialDone <- err
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for client.Status().State != BreakerHalfOpen && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if state := client.Status().State; state != BreakerHalfOpen {
+		t.Fatalf("got state %s, want half_open", state)
+	}
+
+	before := requests.Load()
+	if _, err := client.ListTeachers(context.Background(), ListOptions{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got error %v during the trial, want ErrCircuitOpen", err)
+	}
+
+	close(release)
+	if err := <-trialDone; err != nil {
+		t.Fatalf("trial failed: %v", err)
+	}
+
+	if got := requests.Load() - before; got > 1 {
+		t.Errorf("got %d requests during the trial, want only the trial", got)
+	}
+
+	status := client.Status()
+	if status.State != BreakerClosed || status.OpenedAt != nil || status.ConsecutiveFailures != 0 {
+		t.Errorf("got status %+v after a successful trial, want closed", status)
+	}
+}
+
+func TestBreakerFailedTrialReopens(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, WithBreaker(BreakerConfig{FailureThreshold: 3, Cooldown: 20 * time.Millisecond}))
+
+	for i := 0; i < 3; i++ {
+		client.ListTeachers(context.Background(), ListOptions{})
+	}
+	opened := client.Status().OpenedAt
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := client.ListTeachers(context.Background(), ListOptions{}); !errors.Is(err, ErrServer) {
+		t.Fatalf("got error %v from the trial, want ErrServer", err)
+	}
+
+	status := client.Status()
+	if status.State != BreakerOpen || status.OpenedAt == nil || !status.OpenedAt.After(*opened) {
+		t.Errorf("got status %+v after a failed trial, want reopened", status)
+	}
+}
+
+func TestDecodeErrorIsPermanent(t *testing.T) {
+	client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"teachers":"not a list"}`)
+	}, WithBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour}))
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.ListTeachers(context.Background(), ListOptions{}); !errors.Is(err, ErrInvalidResponse) {
+			t.Fatalf("got error %v, want ErrInvalidResponse", err)
+		}
+	}
+
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want no retries", got)
+	}
+
+	status := client.Status()
+	if status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("got status %+v, want decode errors not counted against the breaker", status)
+	}
+}
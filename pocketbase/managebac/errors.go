@@ -0,0 +1,90 @@
+package managebac
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrUnauthorized is returned when the auth token is missing or invalid (401)
+	ErrUnauthorized = errors.New("managebac: unauthorized")
+
+	// ErrForbidden is returned when the auth token lacks a permission (403)
+	ErrForbidden = errors.New("managebac: forbidden")
+
+	// ErrNotFound is returned when the requested resource does not exist (404)
+	ErrNotFound = errors.New("managebac: not found")
+
+	// ErrRateLimited is returned when ManageBac throttles the client (429)
+	ErrRateLimited = errors.New("managebac: rate limited")
+
+	// ErrServer is returned for any 5xx response
+	ErrServer = errors.New("managebac: server error")
+
+	// ErrInvalidResponse is returned when a 200 response cannot be decoded,
+	// eg. after a change to the API. Retrying will not help.
+	ErrInvalidResponse = errors.New("managebac: invalid response")
+)
+
+// APIError describes a non-200 response from ManageBac. Use errors.Is with the
+// Err* values above to check which kind of failure occurred.
+type APIError struct {
+	StatusCode int
+	// RetryAfter is parsed from the Retry-After header, zero if not sent
+	RetryAfter time.Duration
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("managebac: API returned status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("managebac: API returned status code %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrServer
+	}
+	return nil
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Body:       drain(resp.Body, 512),
+	}
+}
+
+// parseRetryAfter accepts both forms of the Retry-After header: a number of
+// seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,28 @@
+package managebac
+
+import (
+	"context"
+	"strconv"
+)
+
+// Parent is a ManageBac parent account
+type Parent struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Archived  bool   `json:"archived"`
+	ChildIDs  []int  `json:"child_ids,omitempty"`
+}
+
+// GetParent returns the parent with the given ManageBac ID
+func (c *Client) GetParent(ctx context.Context, parentID int) (*Parent, error) {
+	var resp struct {
+		Parent Parent `json:"parent"`
+	}
+	if err := c.get(ctx, "/parents/"+strconv.Itoa(parentID), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Parent, nil
+}
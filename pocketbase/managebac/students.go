@@ -0,0 +1,73 @@
+package managebac
+
+import (
+	"context"
+	"net/url"
+)
+
+// Student is a ManageBac student account
+type Student struct {
+	ID                int      `json:"id"`
+	AccountUID        string   `json:"account_uid,omitempty"`
+	Archived          bool     `json:"archived"`
+	ClassGrade        string   `json:"class_grade,omitempty"`
+	ClassGradeNumber  int      `json:"class_grade_number,omitempty"`
+	CreatedAt         string   `json:"created_at,omitempty"`
+	Email             string   `json:"email"`
+	FirstName         string   `json:"first_name"`
+	MiddleName        string   `json:"middle_name"`
+	LastName          string   `json:"last_name"`
+	GraduatingYear    int      `json:"graduating_year,omitempty"`
+	HomeroomAdvisorID int      `json:"homeroom_advisor_id,omitempty"`
+	Languages         []string `json:"languages,omitempty"`
+	LastAccessedAt    string   `json:"last_accessed_at,omitempty"`
+	Nationalities     []string `json:"nationalities,omitempty"`
+	ParentIDs         []int    `json:"parent_ids,omitempty"`
+	Program           string   `json:"program,omitempty"`
+	ProgramCode       string   `json:"program_code,omitempty"`
+	Role              string   `json:"role,omitempty"`
+	Timezone          string   `json:"timezone,omitempty"`
+	UILanguage        string   `json:"ui_language,omitempty"`
+	UpdatedAt         string   `json:"updated_at,omitempty"`
+	YearGroupID       int      `json:"year_group_id,omitempty"`
+}
+
+// StudentsResponse is a page of students
+type StudentsResponse struct {
+	Students []Student `json:"students"`
+	Meta     Meta      `json:"meta"`
+}
+
+// StudentListOptions filters the student list
+type StudentListOptions struct {
+	ListOptions
+	// Query searches student names, emails and IDs
+	Query string
+}
+
+// ListStudents returns a single page of students matching opts
+func (c *Client) ListStudents(ctx context.Context, opts StudentListOptions) (*StudentsResponse, error) {
+	params := opts.values()
+	if opts.Query != "" {
+		params.Set("q", opts.Query)
+	}
+
+	var resp StudentsResponse
+	if err := c.get(ctx, "/students", params, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetStudent returns the student with the given ManageBac ID
+func (c *Client) GetStudent(ctx context.Context, studentID string) (*Student, error) {
+	var resp struct {
+		Student Student `json:"student"`
+	}
+	if err := c.get(ctx, "/students/"+url.PathEscape(studentID), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Student, nil
+}
@@ -0,0 +1,48 @@
+package managebac
+
+import "context"
+
+// Teacher is a ManageBac teacher account
+type Teacher struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Archived  bool   `json:"archived"`
+}
+
+// TeachersResponse is a page of teachers
+type TeachersResponse struct {
+	Teachers []Teacher `json:"teachers"`
+	Meta     Meta      `json:"meta"`
+}
+
+// ListTeachers returns a single page of teachers
+func (c *Client) ListTeachers(ctx context.Context, opts ListOptions) (*TeachersResponse, error) {
+	var resp TeachersResponse
+	if err := c.get(ctx, "/teachers", opts.values(), &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// ListAllTeachers walks every page of the teacher list
+func (c *Client) ListAllTeachers(ctx context.Context) ([]Teacher, error) {
+	var teachers []Teacher
+
+	opts := ListOptions{Page: 1, PerPage: 200}
+	for {
+		resp, err := c.ListTeachers(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		teachers = append(teachers, resp.Teachers...)
+
+		if !resp.Meta.HasNextPage() || len(resp.Teachers) == 0 {
+			return teachers, nil
+		}
+		opts.Page = resp.Meta.CurrentPage + 1
+	}
+}
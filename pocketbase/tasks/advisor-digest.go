@@ -0,0 +1,346 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/veritymedia/massolit/pocketbase/managebac"
+)
+
+const (
+	// AdvisorDigestScheduleConfigName is the config row holding the cron
+	// expression of the homeroom advisor digest
+	AdvisorDigestScheduleConfigName = "advisor_digest_schedule"
+
+	// DefaultAdvisorDigestSchedule sends the digest at 07:00 every weekday
+	DefaultAdvisorDigestSchedule = "0 7 * * 1-5"
+)
+
+// AdvisorDigest lists what a homeroom advisor needs to know about their
+// tutees each morning
+type AdvisorDigest struct {
+	Advisor     string
+	Date        time.Time
+	Detentions  []DetentionNote
+	NewNotes    []DetentionNote
+	Escalations []Escalation
+}
+
+// IsEmpty reports whether there is nothing to tell the advisor
+func (d AdvisorDigest) IsEmpty() bool {
+	return len(d.Detentions) == 0 && len(d.NewNotes) == 0 && len(d.Escalations) == 0
+}
+
+// normalizeName compares names ignoring case and spacing
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// BuildAdvisorDigests groups today's detentions, the notes created since the
+// last digest was sent and the open escalations by homeroom advisor. Students
+// without an advisor are left out.
+func BuildAdvisorDigests(app *pocketbase.PocketBase, day time.Time) ([]AdvisorDigest, error) {
+	detentions, err := GetDetentionNotesForDay(app, day)
+	if err != nil {
+		return nil, err
+	}
+
+	newNotes, err := getBehaviorNotesCreatedSince(app, advisorDigestSince(app, day))
+	if err != nil {
+		return nil, err
+	}
+
+	escalations, err := GetOpenEscalationsSince(app, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	digests := map[string]*AdvisorDigest{}
+	digestFor := func(advisor string) *AdvisorDigest {
+		key := normalizeName(advisor)
+		if key == "" {
+			return nil
+		}
+		if digests[key] == nil {
+			digests[key] = &AdvisorDigest{Advisor: strings.Join(strings.Fields(advisor), " "), Date: day}
+		}
+		return digests[key]
+	}
+
+	for _, note := range detentions {
+		if digest := digestFor(note.HomeRoomAdvisor); digest != nil {
+			digest.Detentions = append(digest.Detentions, note)
+		}
+	}
+
+	for _, note := range newNotes {
+		if digest := digestFor(note.HomeRoomAdvisor); digest != nil {
+			digest.NewNotes = append(digest.NewNotes, note)
+		}
+	}
+
+	for _, escalation := range escalations {
+		if digest := digestFor(escalation.HomeRoomAdvisor); digest != nil {
+			digest.Escalations = append(digest.Escalations, escalation)
+		}
+	}
+
+	result := make([]AdvisorDigest, 0, len(digests))
+	for _, digest := range digests {
+		result = append(result, *digest)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Advisor < result[j].Advisor
+	})
+
+	return result, nil
+}
+
+// advisorDigestSince returns when the last digest before day was sent, so
+// notes created over weekends and holidays are not missed. Without a previous
+// digest it returns the start of the day before.
+func advisorDigestSince(app *pocketbase.PocketBase, day time.Time) time.Time {
+	lastRun, err := lastReportRunStart(app, EmailTypeAdvisorDigest, reportPeriod(day))
+	if err != nil {
+		log.Printf("Error finding the last advisor digest, listing notes since yesterday: %v", err)
+	}
+	if !lastRun.IsZero() {
+		return lastRun
+	}
+
+	from, _ := dayRange(day.UTC().AddDate(0, 0, -1))
+
+	return from.Time()
+}
+
+// getBehaviorNotesCreatedSince returns the notes created in ManageBac since
+// the given time, newest first
+func getBehaviorNotesCreatedSince(app *pocketbase.PocketBase, since time.Time) ([]DetentionNote, error) {
+	rules, err := LoadDetentionRules(app)
+	if err != nil {
+		return nil, err
+	}
+
+	from, _ := types.ParseDateTime(since.UTC())
+
+	records, err := app.Dao().FindRecordsByFilter(
+		"behavior_notes",
+		"deleted_at = '' && created_at >= {:from}",
+		"-created_at",
+		500,
+		0,
+		dbx.Params{"from": from.String()},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying behavior notes: %v", err)
+	}
+
+	notes := make([]DetentionNote, 0, len(records))
+	for _, record := range records {
+		note := detentionNoteFromRecord(record)
+		rules.Classify(&note)
+		notes = append(notes, note)
+	}
+
+	return notes, nil
+}
+
+// advisorDirectory maps normalised homeroom advisor names to email addresses
+type advisorDirectory map[string]string
+
+// loadAdvisorDirectory finds the email addresses of the given advisors. Rows
+// in the advisor_emails collection take precedence; anyone left is looked up
+// by name in the ManageBac teacher list.
+func loadAdvisorDirectory(ctx context.Context, app *pocketbase.PocketBase, client *managebac.Client, advisors []string) (advisorDirectory, error) {
+	directory := advisorDirectory{}
+
+	records, err := app.Dao().FindRecordsByFilter("advisor_emails", "id != ''", "", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error loading advisor_emails: %v", err)
+	}
+
+	for _, record := range records {
+		directory[normalizeName(record.GetString("homeroom_advisor"))] = record.GetString("email")
+	}
+
+	missing := false
+	for _, advisor := range advisors {
+		if directory[normalizeName(advisor)] == "" {
+			missing = true
+			break
+		}
+	}
+
+	if !missing || client == nil {
+		return directory, nil
+	}
+
+	teachers, err := client.ListAllTeachers(ctx)
+	if err != nil {
+		// The mapping collection may still cover most advisors
+		log.Printf("Error fetching ManageBac teachers: %v", err)
+		return directory, nil
+	}
+
+	for _, teacher := range teachers {
+		name := normalizeName(teacher.FirstName + " " + teacher.LastName)
+		if teacher.Archived || teacher.Email == "" || directory[name] != "" {
+			continue
+		}
+		directory[name] = teacher.Email
+	}
+
+	return directory, nil
+}
+
+// HandleAdvisorDigestSend emails each homeroom advisor their digest. It only
+// runs on teaching days and once per day.
+func HandleAdvisorDigestSend(ctx context.Context, app *pocketbase.PocketBase, client *managebac.Client, trigger string) error {
+	now := time.Now()
+	period := reportPeriod(now)
+
+	if teaching, err := IsTeachingDay(app, now); err != nil {
+		log.Printf("Error checking school calendar, sending the digest anyway: %v", err)
+	} else if !teaching {
+		fmt.Printf("CRON::ADVISOR_DIGEST %s is not a teaching day, skipping\n", period)
+		return nil
+	}
+
+	run, err := claimReportRun(app, EmailTypeAdvisorDigest, period, trigger)
+	if errors.Is(err, ErrReportAlreadyRun) {
+		fmt.Printf("CRON::ADVISOR_DIGEST Digest for %s has already been sent, skipping\n", period)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	digests, err := BuildAdvisorDigests(app, now)
+	if err != nil {
+		finishReportRun(app, run, ReportRunFailed, err)
+		return err
+	}
+
+	if len(digests) == 0 {
+		fmt.Println("CRON::ADVISOR_DIGEST Nothing to report to homeroom advisors")
+		finishReportRun(app, run, ReportRunEmpty, nil)
+		return nil
+	}
+
+	if err := SendAdvisorDigests(ctx, app, client, digests); err != nil {
+		log.Printf("Error sending advisor digests: %v", err)
+		finishReportRun(app, run, ReportRunFailed, err)
+		return err
+	}
+
+	finishReportRun(app, run, ReportRunSent, nil)
+
+	return nil
+}
+
+// SendAdvisorDigests emails every advisor with something to report. Advisors
+// without a known email address are logged and skipped.
+func SendAdvisorDigests(ctx context.Context, app *pocketbase.PocketBase, client *managebac.Client, digests []AdvisorDigest) error {
+	advisors := make([]string, 0, len(digests))
+	for _, digest := range digests {
+		advisors = append(advisors, digest.Advisor)
+	}
+
+	directory, err := loadAdvisorDirectory(ctx, app, client, advisors)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, digest := range digests {
+		if digest.IsEmpty() {
+			continue
+		}
+
+		email := directory[normalizeName(digest.Advisor)]
+		if email == "" {
+			fmt.Printf("CRON::ADVISOR_DIGEST No email address for homeroom advisor %s, add one to advisor_emails\n", digest.Advisor)
+			continue
+		}
+
+		// A retried run skips advisors who already got their digest
+		if sent, err := hasReceivedEmail(app, email, EmailTypeAdvisorDigest, digest.Date); err != nil {
+			log.Printf("Error checking email log for %s: %v", email, err)
+		} else if sent {
+			continue
+		}
+
+		if err := sendAdvisorDigest(app, email, digest); err != nil {
+			errs = append(errs, fmt.Errorf("error sending digest to %s: %v", email, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// advisorDigestEmail is the data passed to the advisor digest templates
+type advisorDigestEmail struct {
+	Advisor     string
+	Date        string
+	AppURL      string
+	Escalations []escalationRow
+	Tables      []detentionTable
+}
+
+// renderAdvisorDigest renders the HTML and plain text parts of a digest email
+func renderAdvisorDigest(app *pocketbase.PocketBase, digest AdvisorDigest) (string, string, error) {
+	data := advisorDigestEmail{
+		Advisor: digest.Advisor,
+		Date:    digest.Date.Format("Monday 2 January"),
+		AppURL:  appURL(app),
+	}
+
+	for _, escalation := range digest.Escalations {
+		data.Escalations = append(data.Escalations, newEscalationRow(escalation))
+	}
+
+	if len(digest.Detentions) > 0 {
+		data.Tables = append(data.Tables, newDetentionTable("Detentions Today", "Incident Date", digest.Detentions, func(note DetentionNote) string {
+			return PrettyFormatDate(note.IncidentTime)
+		}))
+	}
+
+	if len(digest.NewNotes) > 0 {
+		data.Tables = append(data.Tables, newDetentionTable("New Behaviour Notes", "Created", digest.NewNotes, func(note DetentionNote) string {
+			return PrettyFormatDate(note.CreatedAt)
+		}))
+	}
+
+	return renderEmail(app, AdvisorDigestTemplate, data)
+}
+
+func sendAdvisorDigest(app *pocketbase.PocketBase, email string, digest AdvisorDigest) error {
+	htmlBody, textBody, err := renderAdvisorDigest(app, digest)
+	if err != nil {
+		return err
+	}
+
+	message := &mailer.Message{
+		From: mail.Address{
+			Address: app.Settings().Meta.SenderAddress,
+			Name:    app.Settings().Meta.SenderName,
+		},
+		To:      []mail.Address{{Address: email}},
+		Subject: fmt.Sprintf("Homeroom Digest - %s", digest.Date.Format("2006-01-02")),
+		HTML:    htmlBody,
+		Text:    textBody,
+	}
+
+	return sendEmail(app, EmailTypeAdvisorDigest, message)
+}
@@ -0,0 +1,102 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/veritymedia/massolit/pocketbase/managebac"
+)
+
+// ReconcileDeletedBehaviorNotes compares notes created within the lookback
+// window against ManageBac and flags any that no longer exist upstream by
+// setting deleted_at. It returns the number of notes flagged.
+func ReconcileDeletedBehaviorNotes(ctx context.Context, app *pocketbase.PocketBase, client *managebac.Client, lookback time.Duration) (int, error) {
+	fmt.Println("CRON::BEHAVIOUR_NOTES::RECONCILE Checking for notes deleted in ManageBac")
+
+	windowStart := time.Now().Add(-lookback)
+
+	// Every note created since windowStart has been modified since then too,
+	// so this returns all notes in the window that still exist upstream
+	upstream, err := FetchBehaviorNotes(ctx, client, windowStart.Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("error fetching behavior notes: %w", err)
+	}
+
+	upstreamIDs := make(map[string]bool, len(upstream.BehaviorNotes))
+	for _, note := range upstream.BehaviorNotes {
+		upstreamIDs[strconv.Itoa(note.ID)] = true
+	}
+
+	localFrom, _ := types.ParseDateTime(windowStart)
+
+	local, err := app.Dao().FindRecordsByFilter(
+		"behavior_notes",
+		"managebac_id != '' && deleted_at = '' && created_at >= {:from}",
+		"",
+		0,
+		0,
+		dbx.Params{"from": localFrom.String()},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error querying behavior notes: %v", err)
+	}
+
+	// An empty response for a window that has local notes is far more likely
+	// to be an API problem than every note being deleted
+	if len(upstreamIDs) == 0 && len(local) > 0 {
+		return 0, fmt.Errorf("ManageBac returned no notes for a window with %d local notes, skipping reconciliation", len(local))
+	}
+
+	flagged := 0
+	for _, record := range local {
+		if upstreamIDs[record.GetString("managebac_id")] {
+			continue
+		}
+
+		record.Set("deleted_at", types.NowDateTime())
+		if err := app.Dao().SaveRecord(record); err != nil {
+			log.Printf("Error flagging deleted behavior note %s: %v", record.Id, err)
+			continue
+		}
+
+		fmt.Printf("CRON::BEHAVIOUR_NOTES::RECONCILE Note %s (%s %s) no longer exists in ManageBac\n",
+			record.GetString("managebac_id"), record.GetString("first_name"), record.GetString("last_name"))
+		flagged++
+	}
+
+	fmt.Printf("CRON::BEHAVIOUR_NOTES::RECONCILE Flagged %d of %d notes as deleted\n", flagged, len(local))
+
+	return flagged, nil
+}
+
+// FlagUnlinkedBehaviorNotes flags every note still without a ManageBac ID by
+// setting deleted_at. It must only run after a full sync, which links every
+// note that still exists upstream, so the rows left over are duplicates saved
+// before notes were matched by ManageBac ID. It returns the number of notes
+// flagged.
+func FlagUnlinkedBehaviorNotes(app *pocketbase.PocketBase) (int, error) {
+	unlinked, err := app.Dao().FindRecordsByFilter("behavior_notes", "managebac_id = '' && deleted_at = ''", "", 0, 0)
+	if err != nil {
+		return 0, fmt.Errorf("error querying unlinked behavior notes: %v", err)
+	}
+
+	flagged := 0
+	for _, record := range unlinked {
+		record.Set("deleted_at", types.NowDateTime())
+		if err := app.Dao().SaveRecord(record); err != nil {
+			log.Printf("Error flagging unlinked behavior note %s: %v", record.Id, err)
+			continue
+		}
+		flagged++
+	}
+
+	fmt.Printf("CRON::BEHAVIOUR_NOTES::RECONCILE Flagged %d notes without a ManageBac ID as deleted\n", flagged)
+
+	return flagged, nil
+}
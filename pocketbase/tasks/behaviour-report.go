@@ -1,228 +1,341 @@
 package tasks
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/mail"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
 	"github.com/pocketbase/pocketbase/tools/mailer"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
 type DetentionNote struct {
 	BehaviorNote
-	DetenionComplete bool `json:"detention_complete"`
+	// RecordID is the id of the behavior_notes record
+	RecordID         string `json:"record_id"`
+	DetenionComplete bool   `json:"detention_complete"`
+	// Category and Severity come from the detention rule matching the note
+	Category string  `json:"category"`
+	Severity float64 `json:"severity"`
 }
 
-func HandleDetentionReportSend(app *pocketbase.PocketBase) error {
-	fmt.Println("CRON::DETENTION_REPORT Starting detention report generation")
-	
-	mailListRecord, err := app.Dao().FindRecordsByFilter("mail_list", "subs~'behavior'", "", 100, 0)
+// ReportMode selects which detentions the daily report lists
+type ReportMode string
+
+const (
+	// ReportModeToday lists detentions scheduled for today by next_step_date
+	ReportModeToday ReportMode = "today"
+	// ReportModeOutstanding lists incomplete detentions created in the last 7 days
+	ReportModeOutstanding ReportMode = "outstanding"
+)
+
+const (
+	// OverdueDetentionLookbackConfigName is the config row holding how many days
+	// back the overdue section of the report looks
+	OverdueDetentionLookbackConfigName = "overdue_detention_lookback_days"
+
+	// DefaultOverdueDetentionLookbackDays is used when the config row is not set
+	DefaultOverdueDetentionLookbackDays = 14
+)
+
+// DetentionReport holds everything shown in a detention report email
+type DetentionReport struct {
+	Mode        ReportMode
+	Date        time.Time
+	Detentions  []DetentionNote
+	Overdue     []DetentionNote
+	Escalations []Escalation
+}
+
+// IsEmpty reports whether the report has nothing worth sending
+func (r DetentionReport) IsEmpty() bool {
+	return len(r.Detentions) == 0 && len(r.Overdue) == 0 && len(r.Escalations) == 0
+}
+
+// BuildDetentionReport collects the detentions for the given mode and day. It
+// only reads existing escalations, see EvaluateEscalations.
+func BuildDetentionReport(app *pocketbase.PocketBase, mode ReportMode, day time.Time) (DetentionReport, error) {
+	report := DetentionReport{Mode: mode, Date: day}
+
+	var err error
+	switch mode {
+	case ReportModeOutstanding:
+		report.Detentions, err = GetDetentionNotes(app)
+	default:
+		report.Mode = ReportModeToday
+		report.Detentions, err = GetDetentionNotesForDay(app, day)
+	}
 	if err != nil {
-		return fmt.Errorf("Could not find mail_list records: %v", err)
+		return report, fmt.Errorf("Error fetching detention notes: %v", err)
 	}
 
-	recipients := []mail.Address{}
-	for _, record := range mailListRecord {
-		recipients = append(recipients, mail.Address{Address: record.GetString("email")})
+	// Detentions whose date has passed without being marked complete
+	report.Overdue, err = GetOverdueDetentionNotes(app, day)
+	if err != nil {
+		return report, fmt.Errorf("Error fetching overdue detention notes: %v", err)
 	}
-	
-	fmt.Printf("CRON::DETENTION_REPORT Found %d email recipients\n", len(recipients))
 
-	// Get regular detention notes
-	notes, err := GetDetentionNotes(app)
+	// Include every open escalation that has not been sent in a report yet
+	report.Escalations, err = GetUnreportedEscalations(app)
 	if err != nil {
-		return fmt.Errorf("Error fetching detention notes: %v", err)
+		return report, fmt.Errorf("Error fetching escalations: %v", err)
 	}
 
-	// Get double detention alerts
-	doubleDetentions, err := CheckDoubleDetentions(app)
+	return report, nil
+}
+
+// HandleDetentionReportSend builds and sends today's detention report. The
+// report is only sent once per day, later calls return ErrReportAlreadyRun.
+// Nothing is sent on days the school calendar marks as non-teaching.
+func HandleDetentionReportSend(app *pocketbase.PocketBase, mode ReportMode, trigger string) error {
+	now := time.Now()
+	period := reportPeriod(now)
+
+	if teaching, err := IsTeachingDay(app, now); err != nil {
+		log.Printf("Error checking school calendar, sending the report anyway: %v", err)
+	} else if !teaching {
+		fmt.Printf("CRON::DETENTION_REPORT %s is not a teaching day, skipping\n", period)
+		return nil
+	}
+
+	run, err := claimReportRun(app, EmailTypeDetentionReport, period, trigger)
+	if errors.Is(err, ErrReportAlreadyRun) {
+		fmt.Printf("CRON::DETENTION_REPORT Report for %s has already been sent, skipping\n", period)
+		return err
+	}
 	if err != nil {
-		return fmt.Errorf("Error checking double detentions: %v", err)
+		return err
 	}
 
-	// Send report if there are any detentions or double detention alerts
-	if len(notes) > 0 || len(doubleDetentions) > 0 {
-		fmt.Printf("CRON::DETENTION_REPORT Sending report for %d detention notes and %d double detention alerts\n", len(notes), len(doubleDetentions))
-		if err := SendEnhancedDetentionReport(app, notes, doubleDetentions); err != nil {
-			log.Printf("Error sending detention report: %v", err)
-			return err
-		}
-		fmt.Println("CRON::DETENTION_REPORT Successfully sent detention report")
-	} else {
-		fmt.Println("CRON::DETENTION_REPORT No pending detentions or double detention alerts found")
+	fmt.Printf("CRON::DETENTION_REPORT Starting %s detention report generation\n", mode)
+
+	// Evaluate the escalation policies so the report is up to date
+	if _, err := EvaluateEscalations(app, now); err != nil {
+		log.Printf("Error evaluating escalations: %v", err)
+	}
+
+	report, err := BuildDetentionReport(app, mode, now)
+	if err != nil {
+		finishReportRun(app, run, ReportRunFailed, err)
+		return err
+	}
+
+	// Send report if there are any detentions or escalation alerts
+	if report.IsEmpty() {
+		fmt.Println("CRON::DETENTION_REPORT No pending detentions or escalation alerts found")
+		finishReportRun(app, run, ReportRunEmpty, nil)
+		return nil
+	}
+
+	fmt.Printf("CRON::DETENTION_REPORT Sending report for %d detention notes, %d overdue and %d escalation alerts\n",
+		len(report.Detentions), len(report.Overdue), len(report.Escalations))
+	if err := SendEnhancedDetentionReport(app, report); err != nil {
+		log.Printf("Error sending detention report: %v", err)
+		finishReportRun(app, run, ReportRunFailed, err)
+		return err
 	}
-	
+
+	fmt.Println("CRON::DETENTION_REPORT Successfully sent detention report")
+	finishReportRun(app, run, ReportRunSent, nil)
+
 	return nil
 }
 
-func GetDetentionNotes(app *pocketbase.PocketBase) ([]DetentionNote, error) {
-	collection, err := app.Dao().FindCollectionByNameOrId("behavior_notes")
+// dayRange returns the bounds of the calendar day of t. ManageBac sends
+// next_step_date as a plain date, which is stored as midnight UTC, so the day
+// is compared in UTC rather than in the server's time zone.
+func dayRange(t time.Time) (types.DateTime, types.DateTime) {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	from, _ := types.ParseDateTime(start)
+	to, _ := types.ParseDateTime(start.AddDate(0, 0, 1))
+
+	return from, to
+}
+
+// GetDetentionNotesForDay gets the detentions scheduled for the given day by next_step_date
+func GetDetentionNotesForDay(app *pocketbase.PocketBase, day time.Time) ([]DetentionNote, error) {
+	rules, err := LoadDetentionRules(app)
 	if err != nil {
-		return nil, fmt.Errorf("collection not found: %v", err)
+		return nil, err
 	}
 
-	// Calculate the date 7 days ago for rolling window check
-	sevenDaysAgo := time.Now().AddDate(0, 0, -7).Format(time.RFC3339)
-	
-	// Query for detention notes within the last 7 days that are not action_complete
-	filter := fmt.Sprintf("next_step ~ 'Detention' && action_complete = false && created_at >= '%s'", sevenDaysAgo)
-	
-	results, err := app.Dao().FindRecordsByFilter(collection.Name, filter, "-created_at", 200, 0)
+	from, to := dayRange(day)
+
+	detentionNotes, err := findDetentionNotes(
+		app,
+		rules,
+		true,
+		"deleted_at = '' && next_step_date >= {:from} && next_step_date < {:to}",
+		dbx.Params{"from": from.String(), "to": to.String()},
+		"last_name,first_name",
+		500,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("error querying detention notes: %v", err)
+		return nil, fmt.Errorf("error querying detention notes for %s: %v", day.Format("2006-01-02"), err)
 	}
 
-	fmt.Printf("Found %d detention notes within the last 7 days\n", len(results))
+	fmt.Printf("Found %d detention notes scheduled for %s\n", len(detentionNotes), day.Format("2006-01-02"))
 
-	var detentionNotes []DetentionNote
-	for _, record := range results {
-		// Convert author_id from string to int
-		authorID := 0
-		if authorIDStr := record.GetString("author_id"); authorIDStr != "" {
-			if id, err := strconv.Atoi(authorIDStr); err == nil {
-				authorID = id
-			}
-		}
+	return detentionNotes, nil
+}
 
-		note := DetentionNote{
-			BehaviorNote: BehaviorNote{
-				ID:                0, // Not using ManageBac ID for grouping, use PocketBase record ID
-				StudentID:         record.GetString("student_id"),
-				FirstName:         record.GetString("first_name"),
-				LastName:          record.GetString("last_name"),
-				Email:             record.GetString("email"),
-				Grade:             record.GetString("grade"),
-				IncidentTime:      record.GetString("incident_time"),
-				BehaviorType:      record.GetString("behavior_type"),
-				Notes:             record.GetString("notes"),
-				NextStep:          record.GetString("next_step"),
-				NextStepDate:      record.GetString("next_step_date"),
-				AuthorID:          authorID,
-				ReportedBy:        record.GetString("reported_by"),
-				HomeRoomAdvisor:   record.GetString("homeroom_advisor"),
-				VisibleToParents:  record.GetString("visible_to_parents") == "true",
-				VisibleToStudents: record.GetString("visible_to_students") == "true",
-				CreatedAt:         record.GetString("created_at"),
-				UpdatedAt:         record.GetString("updated_at"),
-				ActionComplete:    record.GetBool("action_complete"),
-			},
-			DetenionComplete: record.GetBool("detention_complete"),
-		}
-		detentionNotes = append(detentionNotes, note)
+// GetOverdueDetentionNotes gets detentions scheduled before the given day that
+// have not been marked action_complete, newest first. Only detentions within
+// the overdue_detention_lookback_days config row (14 by default) are listed,
+// older ones are assumed to have been dealt with in ManageBac.
+func GetOverdueDetentionNotes(app *pocketbase.PocketBase, day time.Time) ([]DetentionNote, error) {
+	rules, err := LoadDetentionRules(app)
+	if err != nil {
+		return nil, err
 	}
 
+	from, _ := dayRange(day)
+	lookback := GetConfigInt(app, OverdueDetentionLookbackConfigName, DefaultOverdueDetentionLookbackDays)
+	since, _ := dayRange(day.AddDate(0, 0, -lookback))
+
+	detentionNotes, err := findDetentionNotes(
+		app,
+		rules,
+		true,
+		"action_complete = false && deleted_at = '' && next_step_date >= {:since} && next_step_date < {:from}",
+		dbx.Params{"since": since.String(), "from": from.String()},
+		"-next_step_date",
+		500,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying overdue detention notes: %v", err)
+	}
+
+	fmt.Printf("Found %d overdue detention notes\n", len(detentionNotes))
+
 	return detentionNotes, nil
 }
 
-// GetAllDetentionNotesInWindow gets ALL detention notes (completed or not) within 7-day window
-func GetAllDetentionNotesInWindow(app *pocketbase.PocketBase) ([]DetentionNote, error) {
-	collection, err := app.Dao().FindCollectionByNameOrId("behavior_notes")
+func GetDetentionNotes(app *pocketbase.PocketBase) ([]DetentionNote, error) {
+	rules, err := LoadDetentionRules(app)
 	if err != nil {
-		return nil, fmt.Errorf("collection not found: %v", err)
+		return nil, err
 	}
 
 	// Calculate the date 7 days ago for rolling window check
-	sevenDaysAgo := time.Now().AddDate(0, 0, -7).Format(time.RFC3339)
-	
-	// Query for ALL detention notes within the last 7 days (including lunchtime detention, completed or not)
-	filter := fmt.Sprintf("(next_step ~ 'Detention' || next_step ~ 'Lunchtime') && created_at >= '%s'", sevenDaysAgo)
-	
-	results, err := app.Dao().FindRecordsByFilter(collection.Name, filter, "-created_at", 500, 0)
+	sevenDaysAgo, _ := types.ParseDateTime(time.Now().AddDate(0, 0, -7))
+
+	// Query for reportable detention notes within the last 7 days that are not action_complete
+	detentionNotes, err := findDetentionNotes(
+		app,
+		rules,
+		true,
+		"action_complete = false && deleted_at = '' && created_at >= {:since}",
+		dbx.Params{"since": sevenDaysAgo.String()},
+		"-created_at",
+		200,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("error querying all detention notes: %v", err)
+		return nil, fmt.Errorf("error querying detention notes: %v", err)
 	}
 
-	var detentionNotes []DetentionNote
-	for _, record := range results {
-		// Convert author_id from string to int
-		authorID := 0
-		if authorIDStr := record.GetString("author_id"); authorIDStr != "" {
-			if id, err := strconv.Atoi(authorIDStr); err == nil {
-				authorID = id
-			}
-		}
-
-		note := DetentionNote{
-			BehaviorNote: BehaviorNote{
-				ID:                0, // Not using ManageBac ID for grouping, use PocketBase record ID
-				StudentID:         record.GetString("student_id"),
-				FirstName:         record.GetString("first_name"),
-				LastName:          record.GetString("last_name"),
-				Email:             record.GetString("email"),
-				Grade:             record.GetString("grade"),
-				IncidentTime:      record.GetString("incident_time"),
-				BehaviorType:      record.GetString("behavior_type"),
-				Notes:             record.GetString("notes"),
-				NextStep:          record.GetString("next_step"),
-				NextStepDate:      record.GetString("next_step_date"),
-				AuthorID:          authorID,
-				ReportedBy:        record.GetString("reported_by"),
-				HomeRoomAdvisor:   record.GetString("homeroom_advisor"),
-				VisibleToParents:  record.GetString("visible_to_parents") == "true",
-				VisibleToStudents: record.GetString("visible_to_students") == "true",
-				CreatedAt:         record.GetString("created_at"),
-				UpdatedAt:         record.GetString("updated_at"),
-				ActionComplete:    record.GetBool("action_complete"),
-			},
-			DetenionComplete: record.GetBool("detention_complete"),
-		}
-		detentionNotes = append(detentionNotes, note)
-	}
+	fmt.Printf("Found %d detention notes within the last 7 days\n", len(detentionNotes))
 
 	return detentionNotes, nil
 }
 
-// StudentDetentionSummary represents a student with multiple detentions
-type StudentDetentionSummary struct {
-	StudentID       string
-	FirstName       string
-	LastName        string
-	Email           string
-	Grade           string
-	DetentionCount  int
-	DetentionNotes  []DetentionNote
+// detentionNoteFromRecord converts a behavior_notes record back into the
+// ManageBac note shape used by the reports
+func detentionNoteFromRecord(record *models.Record) DetentionNote {
+	// Convert author_id and managebac_id from string to int
+	authorID, _ := strconv.Atoi(record.GetString("author_id"))
+	managebacID, _ := strconv.Atoi(record.GetString("managebac_id"))
+
+	return DetentionNote{
+		BehaviorNote: BehaviorNote{
+			ID:                managebacID,
+			StudentID:         record.GetString("student_id"),
+			FirstName:         record.GetString("first_name"),
+			LastName:          record.GetString("last_name"),
+			Email:             record.GetString("email"),
+			Grade:             record.GetString("grade"),
+			IncidentTime:      formatRecordDate(record, "incident_time"),
+			BehaviorType:      record.GetString("behavior_type"),
+			Notes:             record.GetString("notes"),
+			NextStep:          record.GetString("next_step"),
+			NextStepDate:      formatRecordDate(record, "next_step_date"),
+			AuthorID:          authorID,
+			ReportedBy:        record.GetString("reported_by"),
+			HomeRoomAdvisor:   record.GetString("homeroom_advisor"),
+			VisibleToParents:  record.GetBool("visible_to_parents"),
+			VisibleToStudents: record.GetBool("visible_to_students"),
+			CreatedAt:         formatRecordDate(record, "created_at"),
+			UpdatedAt:         formatRecordDate(record, "updated_at"),
+			ActionComplete:    record.GetBool("action_complete"),
+		},
+		RecordID:         record.Id,
+		DetenionComplete: record.GetBool("detention_complete"),
+	}
+}
+
+// formatRecordDate returns a date field as RFC3339, or an empty string if unset
+func formatRecordDate(record *models.Record, field string) string {
+	date := record.GetDateTime(field)
+	if date.IsZero() {
+		return ""
+	}
+
+	return date.Time().Format(time.RFC3339)
 }
 
-// CheckDoubleDetentions identifies students with multiple detentions in 7-day window
-func CheckDoubleDetentions(app *pocketbase.PocketBase) ([]StudentDetentionSummary, error) {
-	allDetentions, err := GetAllDetentionNotesInWindow(app)
+// findDetentionNotes returns the notes matching filter and any of the rules
+// (only the reportable ones if reportOnly is set), each tagged with the
+// category and severity of the rule that applies to it
+func findDetentionNotes(app *pocketbase.PocketBase, rules DetentionRules, reportOnly bool, filter string, params dbx.Params, sort string, limit int) ([]DetentionNote, error) {
+	queryRules := rules
+	if reportOnly {
+		queryRules = rules.Reportable()
+	}
+
+	rulesFilter, rulesParams, ok := queryRules.Filter()
+	if !ok {
+		return nil, nil
+	}
+
+	for k, v := range rulesParams {
+		params[k] = v
+	}
+
+	results, err := app.Dao().FindRecordsByFilter("behavior_notes", rulesFilter+" && "+filter, sort, limit, 0, params)
 	if err != nil {
-		return nil, fmt.Errorf("error getting all detention notes: %v", err)
-	}
-
-	// Group detentions by student
-	studentDetentions := make(map[string][]DetentionNote)
-	for _, detention := range allDetentions {
-		studentID := detention.StudentID
-		studentDetentions[studentID] = append(studentDetentions[studentID], detention)
-	}
-
-	var doubleDetentions []StudentDetentionSummary
-	for studentID, detentions := range studentDetentions {
-		if len(detentions) >= 2 { // Student has 2 or more detentions
-			summary := StudentDetentionSummary{
-				StudentID:      studentID,
-				FirstName:      detentions[0].FirstName,
-				LastName:       detentions[0].LastName,
-				Email:          detentions[0].Email,
-				Grade:          detentions[0].Grade,
-				DetentionCount: len(detentions),
-				DetentionNotes: detentions,
-			}
-			doubleDetentions = append(doubleDetentions, summary)
-		}
+		return nil, err
 	}
 
-	fmt.Printf("Found %d students with multiple detentions in 7-day window\n", len(doubleDetentions))
-	for _, student := range doubleDetentions {
-		fmt.Printf("  - %s %s (%s): %d detentions\n", 
-			student.FirstName, student.LastName, student.Grade, student.DetentionCount)
+	var detentionNotes []DetentionNote
+	for _, record := range results {
+		note := detentionNoteFromRecord(record)
+		rules.Classify(&note)
+		detentionNotes = append(detentionNotes, note)
 	}
 
-	return doubleDetentions, nil
+	return detentionNotes, nil
+}
+
+// StudentDetentionSummary represents a student with multiple detentions
+type StudentDetentionSummary struct {
+	StudentID       string          `json:"student_id"`
+	FirstName       string          `json:"first_name"`
+	LastName        string          `json:"last_name"`
+	Email           string          `json:"email"`
+	Grade           string          `json:"grade"`
+	HomeRoomAdvisor string          `json:"homeroom_advisor"`
+	DetentionCount  int             `json:"detention_count"`
+	TotalSeverity   float64         `json:"total_severity"`
+	DetentionNotes  []DetentionNote `json:"detention_notes"`
 }
 
 func PrettyFormatDate(dateStr string) string {
@@ -265,174 +378,215 @@ func PrettyFormatDate(dateStr string) string {
 	return dateFormat
 }
 
-func generateEnhancedDetentionReportHTML(notes []DetentionNote, doubleDetentions []StudentDetentionSummary) string {
-	var htmlBody string
-
-	htmlBody += fmt.Sprintf(`
-<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Detention Report</title>
-</head>
-<body style="font-family: Arial, sans-serif; line-height: 1.6; max-width: 1000px; margin: 0 auto; background-color: #f9f9f9; color: #333; padding: 20px;">
-    <div class="header" style="background-color: #232363; color: white; padding: 20px; text-align: center; border-radius: 8px;">
-        <h1>Outstanding Detentions Report</h1>
-        <p>Generated on: %s</p>
-        <a style="color: white; font-weight: bold; font-size: 1em;" href="https://massolit.app/behavior">Massolit Detentions</a>
-    </div>
-`, time.Now().Format("2006-01-02 15:04:05"))
-
-	// Add double detention alerts section if any exist
-	if len(doubleDetentions) > 0 {
-		htmlBody += `
-    <div class="alert-section" style="background-color: #ffebee; border: 2px solid #f44336; border-radius: 8px; padding: 20px; margin: 20px 0;">
-        <h2 style="color: #d32f2f; margin-top: 0;">🚨 DOUBLE DETENTION ALERTS</h2>
-        <p style="color: #d32f2f; font-weight: bold;">The following students have received multiple detentions within the last 7 days:</p>
-        <table style="width: 100%; border-collapse: collapse; margin-top: 10px;">
-            <thead>
-                <tr>
-                    <th style="border: 1px solid #f44336; padding: 8px; text-align: left; background-color: #f44336; color: white;">Student</th>
-                    <th style="border: 1px solid #f44336; padding: 8px; text-align: left; background-color: #f44336; color: white;">Grade</th>
-                    <th style="border: 1px solid #f44336; padding: 8px; text-align: left; background-color: #f44336; color: white;">Total Detentions</th>
-                    <th style="border: 1px solid #f44336; padding: 8px; text-align: left; background-color: #f44336; color: white;">Detention Types</th>
-                </tr>
-            </thead>
-            <tbody>`
-
-		for _, student := range doubleDetentions {
-			detentionTypes := make(map[string]int)
-			for _, detention := range student.DetentionNotes {
-				detentionTypes[detention.NextStep]++
-			}
-			
-			var typesList string
-			for detType, count := range detentionTypes {
-				if typesList != "" {
-					typesList += ", "
-				}
-				typesList += fmt.Sprintf("%s (%d)", detType, count)
-			}
+// detentionReportEmail is the data passed to the detention report templates
+type detentionReportEmail struct {
+	Title           string
+	GeneratedAt     string
+	AppURL          string
+	Escalations     []escalationRow
+	Tables          []detentionTable
+	DetentionCount  int
+	OverdueCount    int
+	EscalationCount int
+}
 
-			htmlBody += fmt.Sprintf(`
-                <tr style="background-color: #ffcdd2;">
-                    <td style="border: 1px solid #f44336; padding: 8px;">%s %s</td>
-                    <td style="border: 1px solid #f44336; padding: 8px;">%s</td>
-                    <td style="border: 1px solid #f44336; padding: 8px; font-weight: bold;">%d</td>
-                    <td style="border: 1px solid #f44336; padding: 8px;">%s</td>
-                </tr>`,
-				student.FirstName, student.LastName, student.Grade, student.DetentionCount, typesList)
-		}
+type escalationRow struct {
+	Student        string
+	Grade          string
+	Policy         string
+	WindowDays     int
+	Action         string
+	DetentionCount int
+	DetentionTypes string
+}
+
+type detentionTable struct {
+	Heading     string
+	DateHeading string
+	Rows        []detentionRow
+}
+
+type detentionRow struct {
+	Student    string
+	Grade      string
+	Date       string
+	ReportedBy string
+	Notes      string
+	NextStep   string
+	Category   string
+}
+
+// renderDetentionReport renders the HTML and plain text parts of a report email
+func renderDetentionReport(app *pocketbase.PocketBase, report DetentionReport) (string, string, error) {
+	title := "Outstanding Detentions"
+	if report.Mode == ReportModeToday {
+		title = fmt.Sprintf("Detentions for %s", report.Date.Format("Monday 2 January"))
+	}
+
+	data := detentionReportEmail{
+		Title:           title,
+		GeneratedAt:     time.Now().Format("2006-01-02 15:04:05"),
+		AppURL:          appURL(app),
+		DetentionCount:  len(report.Detentions),
+		OverdueCount:    len(report.Overdue),
+		EscalationCount: len(report.Escalations),
+	}
 
-		htmlBody += `
-            </tbody>
-        </table>
-    </div>`
+	for _, escalation := range report.Escalations {
+		data.Escalations = append(data.Escalations, newEscalationRow(escalation))
 	}
 
 	// Add regular detention table if any exist
-	if len(notes) > 0 {
-		htmlBody += `
-    <h2 style="margin-top: 30px;">Outstanding Detentions</h2>
-    <table style="width: 100%; border-collapse: collapse; margin-top: 20px; border-radius: 8px; overflow: hidden;">
-        <thead>
-            <tr>
-                <th style="border: 1px solid #ddd; padding: 12px; text-align: left; background-color: #232363; color: white; text-transform: uppercase; font-weight: bold;">Student</th>
-                <th style="border: 1px solid #ddd; padding: 12px; text-align: left; background-color: #232363; color: white; text-transform: uppercase; font-weight: bold;">Grade</th>
-                <th style="border: 1px solid #ddd; padding: 12px; text-align: left; background-color: #232363; color: white; text-transform: uppercase; font-weight: bold;">Incident Date</th>
-                <th style="border: 1px solid #ddd; padding: 12px; text-align: left; background-color: #232363; color: white; text-transform: uppercase; font-weight: bold;">Reported By</th>
-                <th style="border: 1px solid #ddd; padding: 12px; text-align: left; background-color: #232363; color: white; text-transform: uppercase; font-weight: bold;">Notes</th>
-                <th style="border: 1px solid #ddd; padding: 12px; text-align: left; background-color: #232363; color: white; text-transform: uppercase; font-weight: bold;">Next Step</th>
-            </tr>
-        </thead>
-        <tbody>`
-
-		for i, note := range notes {
-			var bgColor string
-			if i%2 == 0 {
-				bgColor = "#f2f8fc"
-			} else {
-				bgColor = "#ffffff"
-			}
-			htmlBody += fmt.Sprintf(`
-            <tr style="background-color: %s;">
-                <td style="border: 1px solid #ddd; padding: 12px; text-align: left;">%s %s</td>
-                <td style="border: 1px solid #ddd; padding: 12px; text-align: left;">%s</td>
-                <td style="border: 1px solid #ddd; padding: 12px; text-align: left;">%s</td>
-                <td style="border: 1px solid #ddd; padding: 12px; text-align: left;">%s</td>
-                <td style="border: 1px solid #ddd; padding: 12px; text-align: left;">%s</td>
-                <td style="border: 1px solid #ddd; padding: 12px; text-align: left;">%s</td>
-            </tr>
-`, bgColor, note.FirstName, note.LastName, note.Grade, PrettyFormatDate(note.IncidentTime), note.ReportedBy, note.Notes, note.NextStep)
-		}
+	if len(report.Detentions) > 0 {
+		data.Tables = append(data.Tables, newDetentionTable(title, "Incident Date", report.Detentions, func(note DetentionNote) string {
+			return PrettyFormatDate(note.IncidentTime)
+		}))
+	}
 
-		htmlBody += `
-        </tbody>
-    </table>`
+	// Add overdue detentions whose date has passed without being completed
+	if len(report.Overdue) > 0 {
+		data.Tables = append(data.Tables, newDetentionTable("Overdue Detentions", "Detention Date", report.Overdue, func(note DetentionNote) string {
+			return PrettyFormatDate(note.NextStepDate)
+		}))
 	}
 
-	// Summary section
-	htmlBody += fmt.Sprintf(`
-    <div class="summary" style="margin-top: 30px; padding: 15px; background-color: #e3f2fd; border-radius: 8px;">
-        <h3 style="margin-top: 0;">Summary</h3>
-        <p><strong>Total Pending Detentions:</strong> %d</p>
-        <p><strong>Students with Multiple Detentions:</strong> %d</p>
-    </div>
-</body>
-</html>
-`, len(notes), len(doubleDetentions))
+	return renderEmail(app, DetentionReportTemplate, data)
+}
 
-	return htmlBody
+// newEscalationRow summarises an escalation and the detentions behind it
+func newEscalationRow(escalation Escalation) escalationRow {
+	detentionTypes := make(map[string]int)
+	for _, detention := range escalation.DetentionNotes {
+		detentionTypes[detention.NextStep]++
+	}
+
+	types := make([]string, 0, len(detentionTypes))
+	for detType, count := range detentionTypes {
+		types = append(types, fmt.Sprintf("%s (%d)", detType, count))
+	}
+	sort.Strings(types)
+
+	return escalationRow{
+		Student:        escalation.FirstName + " " + escalation.LastName,
+		Grade:          escalation.Grade,
+		Policy:         escalation.PolicyName,
+		WindowDays:     escalation.WindowDays,
+		Action:         escalation.Action,
+		DetentionCount: escalation.DetentionCount,
+		DetentionTypes: strings.Join(types, ", "),
+	}
 }
 
-func SendDetentionReport(app *pocketbase.PocketBase, notes []DetentionNote) error {
-	mailListRecord, err := app.Dao().FindRecordsByFilter("mail_list", "subs~'behavior'", "", 100, 0)
+// newDetentionTable builds a table of detention notes. dateHeading and
+// dateValue choose which date is shown in the first date column.
+func newDetentionTable(heading string, dateHeading string, notes []DetentionNote, dateValue func(DetentionNote) string) detentionTable {
+	table := detentionTable{Heading: heading, DateHeading: dateHeading}
+
+	for _, note := range notes {
+		table.Rows = append(table.Rows, detentionRow{
+			Student:    note.FirstName + " " + note.LastName,
+			Grade:      note.Grade,
+			Date:       dateValue(note),
+			ReportedBy: note.ReportedBy,
+			Notes:      note.Notes,
+			NextStep:   note.NextStep,
+			Category:   note.Category,
+		})
+	}
 
+	return table
+}
+
+// SendEnhancedDetentionReport sends every behavior subscriber the part of the
+// report within their scope. Recipients with nothing in scope, or who were
+// already sent the report that day, get no email. Escalations sent to at least
+// one recipient are marked as reported so the next report leaves them out.
+func SendEnhancedDetentionReport(app *pocketbase.PocketBase, report DetentionReport) error {
+	recipients, err := GetReportRecipients(app, "behavior")
 	if err != nil {
-		return fmt.Errorf("Could not find mail_list records")
+		return err
 	}
 
-	recipients := []mail.Address{}
+	var errs []error
+	reported := map[string]bool{}
+	for _, recipient := range recipients {
+		scoped := report.ForScope(recipient.Scope)
+		if scoped.IsEmpty() {
+			fmt.Printf("CRON::DETENTION_REPORT Nothing to report for %s\n", recipient.Email)
+			continue
+		}
 
-	for _, record := range mailListRecord {
-		recipients = append(recipients, mail.Address{Address: record.GetString("email")})
-	}
+		// A retried run skips recipients who already got the report
+		if sent, err := hasReceivedEmail(app, recipient.Email, EmailTypeDetentionReport, report.Date); err != nil {
+			log.Printf("Error checking email log for %s: %v", recipient.Email, err)
+		} else if sent {
+			fmt.Printf("CRON::DETENTION_REPORT %s has already received the report\n", recipient.Email)
+			continue
+		}
 
-	htmlBody := generateDetentionReportHTML(notes)
+		if err := sendDetentionReportTo(app, recipient.Email, scoped, false); err != nil {
+			errs = append(errs, fmt.Errorf("error sending detention report to %s: %v", recipient.Email, err))
+			continue
+		}
 
-	message := &mailer.Message{
-		From: mail.Address{
-			Address: app.Settings().Meta.SenderAddress,
-			Name:    app.Settings().Meta.SenderName,
-		},
-		To:      recipients,
-		Subject: fmt.Sprintf("Detention Report - %s", time.Now().Format("2006-01-02")),
-		HTML:    htmlBody,
+		for _, escalation := range scoped.Escalations {
+			reported[escalation.ID] = true
+		}
+	}
+
+	// Escalations outside every recipient's scope stay unreported so they are
+	// listed again once someone is subscribed to them
+	ids := make([]string, 0, len(reported))
+	for id := range reported {
+		ids = append(ids, id)
+	}
+	if err := MarkEscalationsReported(app, ids); err != nil {
+		errs = append(errs, err)
 	}
 
-	return app.NewMailClient().Send(message)
+	return errors.Join(errs...)
 }
 
-func SendEnhancedDetentionReport(app *pocketbase.PocketBase, notes []DetentionNote, doubleDetentions []StudentDetentionSummary) error {
-	mailListRecord, err := app.Dao().FindRecordsByFilter("mail_list", "subs~'behavior'", "", 100, 0)
+// PreviewDetentionReport renders the report email a recipient with the given
+// scope would receive for mode and day, without sending it
+func PreviewDetentionReport(app *pocketbase.PocketBase, mode ReportMode, day time.Time, scope ReportScope) (string, string, error) {
+	report, err := BuildDetentionReport(app, mode, day)
+	if err != nil {
+		return "", "", err
+	}
+
+	return renderDetentionReport(app, report.ForScope(scope))
+}
 
+// SendTestDetentionReport sends the report for mode, day and scope to a single
+// address. Unlike the scheduled report it is sent even when empty.
+func SendTestDetentionReport(app *pocketbase.PocketBase, email string, mode ReportMode, day time.Time, scope ReportScope) error {
+	report, err := BuildDetentionReport(app, mode, day)
 	if err != nil {
-		return fmt.Errorf("Could not find mail_list records")
+		return err
 	}
 
-	recipients := []mail.Address{}
+	return sendDetentionReportTo(app, email, report.ForScope(scope), true)
+}
 
-	for _, record := range mailListRecord {
-		recipients = append(recipients, mail.Address{Address: record.GetString("email")})
+// sendDetentionReportTo emails the report to a single recipient. Test reports
+// are marked as such in the subject and the email log.
+func sendDetentionReportTo(app *pocketbase.PocketBase, email string, report DetentionReport, test bool) error {
+	htmlBody, textBody, err := renderDetentionReport(app, report)
+	if err != nil {
+		return err
 	}
 
-	htmlBody := generateEnhancedDetentionReportHTML(notes, doubleDetentions)
+	// Create subject line that indicates if there are escalation alerts
+	subject := fmt.Sprintf("Detention Report - %s", report.Date.Format("2006-01-02"))
+	if len(report.Escalations) > 0 {
+		subject = fmt.Sprintf("🚨 DETENTIONS: Detention Report with %d Escalation Alerts - %s", len(report.Escalations), report.Date.Format("2006-01-02"))
+	}
 
-	// Create subject line that indicates if there are double detention alerts
-	subject := fmt.Sprintf("Detention Report - %s", time.Now().Format("2006-01-02"))
-	if len(doubleDetentions) > 0 {
-		subject = fmt.Sprintf("🚨 DETENTIONS: Detention Report with %d Double Detention Alerts - %s", len(doubleDetentions), time.Now().Format("2006-01-02"))
+	emailType := EmailTypeDetentionReport
+	if test {
+		subject = "[TEST] " + subject
+		emailType = EmailTypeDetentionReportTest
 	}
 
 	message := &mailer.Message{
@@ -440,16 +594,11 @@ func SendEnhancedDetentionReport(app *pocketbase.PocketBase, notes []DetentionNo
 			Address: app.Settings().Meta.SenderAddress,
 			Name:    app.Settings().Meta.SenderName,
 		},
-		To:      recipients,
+		To:      []mail.Address{{Address: email}},
 		Subject: subject,
 		HTML:    htmlBody,
+		Text:    textBody,
 	}
 
-	return app.NewMailClient().Send(message)
+	return sendEmail(app, emailType, message)
 }
-
-// Keep the original function for backward compatibility
-func generateDetentionReportHTML(notes []DetentionNote) string {
-	// Call the enhanced version with empty double detentions
-	return generateEnhancedDetentionReportHTML(notes, []StudentDetentionSummary{})
-}
\ No newline at end of file
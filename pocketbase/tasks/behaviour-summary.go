@@ -0,0 +1,442 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// SummaryPeriod is the length of time a behaviour summary covers
+type SummaryPeriod string
+
+const (
+	SummaryPeriodWeekly SummaryPeriod = "weekly"
+	SummaryPeriodTermly SummaryPeriod = "termly"
+)
+
+// SummarySubscription is the mail_list subscription receiving the summaries
+const SummarySubscription = "summary"
+
+const (
+	// WeeklySummaryScheduleConfigName and TermlySummaryScheduleConfigName are
+	// the config rows holding the cron expressions of the summaries
+	WeeklySummaryScheduleConfigName = "weekly_summary_schedule"
+	TermlySummaryScheduleConfigName = "termly_summary_schedule"
+
+	// DefaultWeeklySummarySchedule sends the summary of the week just ended on
+	// Monday morning
+	DefaultWeeklySummarySchedule = "0 7 * * 1"
+	// DefaultTermlySummarySchedule checks every weekday afternoon whether the
+	// term has ended
+	DefaultTermlySummarySchedule = "0 15 * * 1-5"
+)
+
+// summaryTopStudents is how many repeat students are listed in a summary
+const summaryTopStudents = 10
+
+// SummaryReport holds the behaviour notes of a period and of the period
+// before it, which the summary is compared against
+type SummaryReport struct {
+	Period        SummaryPeriod
+	Label         string
+	PreviousLabel string
+	From          time.Time
+	To            time.Time
+	Notes         []BehaviorNote
+	PreviousNotes []BehaviorNote
+}
+
+// IsEmpty reports whether there were no notes in the period
+func (r SummaryReport) IsEmpty() bool {
+	return len(r.Notes) == 0
+}
+
+// ForScope returns a copy of the report containing only the notes of the
+// students scope includes. Detention categories do not apply to summaries.
+func (r SummaryReport) ForScope(scope ReportScope) SummaryReport {
+	filter := func(notes []BehaviorNote) []BehaviorNote {
+		var filtered []BehaviorNote
+		for _, note := range notes {
+			if scope.includesStudent(note.Grade, note.HomeRoomAdvisor) {
+				filtered = append(filtered, note)
+			}
+		}
+		return filtered
+	}
+
+	r.Notes = filter(r.Notes)
+	r.PreviousNotes = filter(r.PreviousNotes)
+
+	return r
+}
+
+// SummaryCount is the number of notes in a group, eg. a grade, compared with
+// the previous period
+type SummaryCount struct {
+	Name     string
+	Count    int
+	Previous int
+	Change   int
+}
+
+// RepeatStudent is a student with more than one note in the period
+type RepeatStudent struct {
+	Name            string
+	Grade           string
+	HomeRoomAdvisor string
+	Count           int
+	Previous        int
+}
+
+// BuildSummaryReport loads the notes of the weekly or termly period of day.
+// The weekly period is the last full Monday to Sunday week before day, so
+// both weeks compared are complete. The termly period is the term in the
+// school calendar containing day.
+func BuildSummaryReport(app *pocketbase.PocketBase, period SummaryPeriod, day time.Time) (SummaryReport, error) {
+	report := SummaryReport{Period: period}
+
+	var previousFrom, previousTo time.Time
+
+	switch period {
+	case SummaryPeriodWeekly:
+		from, _ := dayRange(day.UTC())
+		start := from.Time()
+		start = start.AddDate(0, 0, -((int(start.Weekday())+6)%7)-7)
+
+		report.From = start
+		report.To = start.AddDate(0, 0, 7)
+		report.Label = fmt.Sprintf("Week of %s", start.Format("2 January 2006"))
+		previousFrom = start.AddDate(0, 0, -7)
+		previousTo = start
+		report.PreviousLabel = "the previous week"
+	case SummaryPeriodTermly:
+		term, err := FindTerm(app, day)
+		if err != nil {
+			return report, err
+		}
+
+		report.From = term.GetDateTime("start_date").Time()
+		report.To = term.GetDateTime("end_date").Time().AddDate(0, 0, 1)
+		report.Label = term.GetString("name")
+
+		previous, err := FindPreviousTerm(app, report.From)
+		if err != nil {
+			return report, err
+		}
+		if previous != nil {
+			previousFrom = previous.GetDateTime("start_date").Time()
+			previousTo = previous.GetDateTime("end_date").Time().AddDate(0, 0, 1)
+			report.PreviousLabel = previous.GetString("name")
+		}
+	default:
+		return report, fmt.Errorf("unknown summary period %s", period)
+	}
+
+	var err error
+	report.Notes, err = getBehaviorNotesBetween(app, report.From, report.To)
+	if err != nil {
+		return report, err
+	}
+
+	if !previousFrom.IsZero() {
+		report.PreviousNotes, err = getBehaviorNotesBetween(app, previousFrom, previousTo)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// getBehaviorNotesBetween returns every note with an incident time in
+// [from, to), leaving out notes deleted in ManageBac
+func getBehaviorNotesBetween(app *pocketbase.PocketBase, from time.Time, to time.Time) ([]BehaviorNote, error) {
+	fromDate, _ := types.ParseDateTime(from)
+	toDate, _ := types.ParseDateTime(to)
+
+	records, err := app.Dao().FindRecordsByFilter(
+		"behavior_notes",
+		"deleted_at = '' && incident_time >= {:from} && incident_time < {:to}",
+		"incident_time",
+		0,
+		0,
+		dbx.Params{"from": fromDate.String(), "to": toDate.String()},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying behavior notes: %v", err)
+	}
+
+	notes := make([]BehaviorNote, 0, len(records))
+	for _, record := range records {
+		notes = append(notes, detentionNoteFromRecord(record).BehaviorNote)
+	}
+
+	return notes, nil
+}
+
+// countBy groups notes by key and compares each group with the previous period.
+// Groups are sorted by their count, largest first.
+func countBy(notes []BehaviorNote, previous []BehaviorNote, key func(BehaviorNote) string) []SummaryCount {
+	groupName := func(note BehaviorNote) string {
+		if name := strings.TrimSpace(key(note)); name != "" {
+			return name
+		}
+		return "Unknown"
+	}
+
+	counts := map[string]*SummaryCount{}
+	group := func(name string) *SummaryCount {
+		if counts[name] == nil {
+			counts[name] = &SummaryCount{Name: name}
+		}
+		return counts[name]
+	}
+
+	for _, note := range notes {
+		group(groupName(note)).Count++
+	}
+
+	for _, note := range previous {
+		group(groupName(note)).Previous++
+	}
+
+	result := make([]SummaryCount, 0, len(counts))
+	for _, count := range counts {
+		count.Change = count.Count - count.Previous
+		result = append(result, *count)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// topRepeatStudents returns the students with the most notes in the period,
+// ignoring those with a single note
+func topRepeatStudents(notes []BehaviorNote, previous []BehaviorNote, limit int) []RepeatStudent {
+	studentKey := func(note BehaviorNote) string {
+		if note.StudentID != "" {
+			return note.StudentID
+		}
+		return strings.ToLower(note.Email)
+	}
+
+	students := map[string]*RepeatStudent{}
+	for _, note := range notes {
+		key := studentKey(note)
+		if students[key] == nil {
+			students[key] = &RepeatStudent{
+				Name:            note.FirstName + " " + note.LastName,
+				Grade:           note.Grade,
+				HomeRoomAdvisor: note.HomeRoomAdvisor,
+			}
+		}
+		students[key].Count++
+	}
+
+	for _, note := range previous {
+		if student := students[studentKey(note)]; student != nil {
+			student.Previous++
+		}
+	}
+
+	var repeat []RepeatStudent
+	for _, student := range students {
+		if student.Count > 1 {
+			repeat = append(repeat, *student)
+		}
+	}
+
+	sort.Slice(repeat, func(i, j int) bool {
+		if repeat[i].Count != repeat[j].Count {
+			return repeat[i].Count > repeat[j].Count
+		}
+		return repeat[i].Name < repeat[j].Name
+	})
+
+	if len(repeat) > limit {
+		repeat = repeat[:limit]
+	}
+
+	return repeat
+}
+
+// behaviorSummaryEmail is the data passed to the behaviour summary templates
+type behaviorSummaryEmail struct {
+	Title          string
+	GeneratedAt    string
+	AppURL         string
+	PreviousLabel  string
+	Total          SummaryCount
+	Sections       []summarySection
+	RepeatStudents []RepeatStudent
+}
+
+type summarySection struct {
+	Heading string
+	Counts  []SummaryCount
+}
+
+// renderSummaryReport renders the HTML and plain text parts of a summary email
+func renderSummaryReport(app *pocketbase.PocketBase, report SummaryReport) (string, string, error) {
+	title := "Weekly Behaviour Summary"
+	if report.Period == SummaryPeriodTermly {
+		title = "End of Term Behaviour Summary"
+	}
+
+	data := behaviorSummaryEmail{
+		Title:         fmt.Sprintf("%s: %s", title, report.Label),
+		GeneratedAt:   time.Now().Format("2006-01-02 15:04:05"),
+		AppURL:        appURL(app),
+		PreviousLabel: report.PreviousLabel,
+		Total: SummaryCount{
+			Name:     "All notes",
+			Count:    len(report.Notes),
+			Previous: len(report.PreviousNotes),
+			Change:   len(report.Notes) - len(report.PreviousNotes),
+		},
+		Sections: []summarySection{
+			{Heading: "By Behaviour Type", Counts: countBy(report.Notes, report.PreviousNotes, func(note BehaviorNote) string { return note.BehaviorType })},
+			{Heading: "By Grade", Counts: countBy(report.Notes, report.PreviousNotes, func(note BehaviorNote) string { return note.Grade })},
+			{Heading: "By Homeroom Advisor", Counts: countBy(report.Notes, report.PreviousNotes, func(note BehaviorNote) string { return note.HomeRoomAdvisor })},
+			{Heading: "By Reporting Teacher", Counts: countBy(report.Notes, report.PreviousNotes, func(note BehaviorNote) string { return note.ReportedBy })},
+		},
+		RepeatStudents: topRepeatStudents(report.Notes, report.PreviousNotes, summaryTopStudents),
+	}
+
+	return renderEmail(app, BehaviorSummaryTemplate, data)
+}
+
+// PreviewSummaryReport renders the summary email a recipient with the given
+// scope would receive for the period containing day, without sending it
+func PreviewSummaryReport(app *pocketbase.PocketBase, period SummaryPeriod, day time.Time, scope ReportScope) (string, string, error) {
+	report, err := BuildSummaryReport(app, period, day)
+	if err != nil {
+		return "", "", err
+	}
+
+	return renderSummaryReport(app, report.ForScope(scope))
+}
+
+// summaryEmailType returns the email_log and report_runs type of a summary
+func summaryEmailType(period SummaryPeriod) string {
+	if period == SummaryPeriodTermly {
+		return EmailTypeTermlySummary
+	}
+
+	return EmailTypeWeeklySummary
+}
+
+// HandleSummaryReportSend sends the weekly or termly summary to the summary
+// subscribers. The termly summary is only sent on the last teaching day of a
+// term. Each summary is sent once per period.
+func HandleSummaryReportSend(app *pocketbase.PocketBase, period SummaryPeriod, trigger string) error {
+	now := time.Now()
+	reportType := summaryEmailType(period)
+	logPrefix := "CRON::" + strings.ToUpper(reportType)
+
+	if period == SummaryPeriodTermly {
+		last, err := IsLastTeachingDayOfTerm(app, now)
+		if err != nil {
+			return err
+		}
+		if !last {
+			return nil
+		}
+	}
+
+	report, err := BuildSummaryReport(app, period, now)
+	if err != nil {
+		return err
+	}
+
+	key := reportPeriod(report.From) + "/" + reportPeriod(report.To.AddDate(0, 0, -1))
+
+	run, err := claimReportRun(app, reportType, key, trigger)
+	if errors.Is(err, ErrReportAlreadyRun) {
+		fmt.Printf("%s Summary for %s has already been sent, skipping\n", logPrefix, key)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if report.IsEmpty() {
+		fmt.Printf("%s No behaviour notes for %s\n", logPrefix, report.Label)
+		finishReportRun(app, run, ReportRunEmpty, nil)
+		return nil
+	}
+
+	fmt.Printf("%s Sending summary of %d behaviour notes for %s\n", logPrefix, len(report.Notes), report.Label)
+	if err := SendSummaryReport(app, report); err != nil {
+		log.Printf("Error sending %s summary: %v", period, err)
+		finishReportRun(app, run, ReportRunFailed, err)
+		return err
+	}
+
+	finishReportRun(app, run, ReportRunSent, nil)
+
+	return nil
+}
+
+// SendSummaryReport sends every summary subscriber the part of the report
+// within their grades and homeroom advisor
+func SendSummaryReport(app *pocketbase.PocketBase, report SummaryReport) error {
+	recipients, err := GetReportRecipients(app, SummarySubscription)
+	if err != nil {
+		return err
+	}
+
+	reportType := summaryEmailType(report.Period)
+
+	var errs []error
+	for _, recipient := range recipients {
+		scoped := report.ForScope(recipient.Scope)
+		if scoped.IsEmpty() {
+			continue
+		}
+
+		// A retried run skips recipients who already got the summary
+		if sent, err := hasReceivedEmail(app, recipient.Email, reportType, time.Now()); err != nil {
+			log.Printf("Error checking email log for %s: %v", recipient.Email, err)
+		} else if sent {
+			continue
+		}
+
+		htmlBody, textBody, err := renderSummaryReport(app, scoped)
+		if err != nil {
+			return err
+		}
+
+		message := &mailer.Message{
+			From: mail.Address{
+				Address: app.Settings().Meta.SenderAddress,
+				Name:    app.Settings().Meta.SenderName,
+			},
+			To:      []mail.Address{{Address: recipient.Email}},
+			Subject: fmt.Sprintf("Behaviour Summary - %s", report.Label),
+			HTML:    htmlBody,
+			Text:    textBody,
+		}
+
+		if err := sendEmail(app, reportType, message); err != nil {
+			errs = append(errs, fmt.Errorf("error sending summary to %s: %v", recipient.Email, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,442 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/veritymedia/massolit/pocketbase/managebac"
+)
+
+// LastBehaviorSyncConfigName is the config row holding the modified_since
+// cursor for the behaviour note sync
+const LastBehaviorSyncConfigName = "last_behavior_sync_datetime"
+
+// BehaviorSyncIntervalConfigName is the config row holding how often
+// behaviour notes are synced, eg. "10m"
+const BehaviorSyncIntervalConfigName = "behavior_sync_interval"
+
+// MinBehaviorSyncInterval is the shortest sync interval accepted, to stay
+// within ManageBac's rate limits
+const MinBehaviorSyncInterval = time.Minute
+
+const (
+	SyncTriggerScheduled = "scheduled"
+	SyncTriggerManual    = "manual"
+
+	SyncStatusRunning = "running"
+	SyncStatusSuccess = "success"
+	SyncStatusFailed  = "failed"
+)
+
+// ManualSyncTimeout bounds a sync started from the API with RunManual
+const ManualSyncTimeout = 10 * time.Minute
+
+// ErrSyncInProgress is returned when a sync is requested while another is running
+var ErrSyncInProgress = errors.New("a behaviour note sync is already running")
+
+// SyncResult summarises a single behaviour note sync run
+type SyncResult struct {
+	RunID         string    `json:"run_id"`
+	Trigger       string    `json:"trigger"`
+	Status        string    `json:"status"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+	ModifiedSince string    `json:"modified_since"`
+	FetchedCount  int       `json:"fetched_count"`
+	SavedCount    int       `json:"saved_count"`
+	FailedCount   int       `json:"failed_count"`
+	DeletedCount  int       `json:"deleted_count"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// SyncService periodically pulls behaviour notes from ManageBac into the
+// behavior_notes collection and records every run in behavior_sync_runs
+type SyncService struct {
+	app    *pocketbase.PocketBase
+	client *managebac.Client
+
+	// defaultInterval is used while the behavior_sync_interval config row is
+	// not set. intervalChanged passes a new interval to the running ticker.
+	defaultInterval time.Duration
+	interval        time.Duration
+	intervalMu      sync.Mutex
+	intervalChanged chan time.Duration
+
+	// reconcileEvery and reconcileLookback control the pass that flags notes
+	// deleted in ManageBac. Reconciliation is disabled while reconcileEvery is 0.
+	reconcileEvery    time.Duration
+	reconcileLookback time.Duration
+	lastReconciledAt  time.Time
+
+	// notifyParents emails parents about new detentions after each sync
+	notifyParents bool
+
+	// skippedDay is the last non-teaching day a scheduled sync was skipped on
+	skippedDay string
+
+	// running prevents scheduled and manual runs from overlapping
+	running sync.Mutex
+
+	// ctx is cancelled by Stop, ending scheduled and manual runs alike
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSyncService creates a sync service that runs at the interval in the
+// behavior_sync_interval config row once started, or every defaultInterval
+// if the row is not set
+func NewSyncService(app *pocketbase.PocketBase, client *managebac.Client, defaultInterval time.Duration) *SyncService {
+	return &SyncService{
+		app:             app,
+		client:          client,
+		defaultInterval: defaultInterval,
+		interval:        defaultInterval,
+		intervalChanged: make(chan time.Duration, 1),
+	}
+}
+
+// ValidateSyncInterval parses a behavior_sync_interval config value
+func ValidateSyncInterval(value string) (time.Duration, error) {
+	interval, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid sync interval '%s', use eg. 5m or 1h", value)
+	}
+	if interval < MinBehaviorSyncInterval {
+		return 0, fmt.Errorf("sync interval must be at least %s", MinBehaviorSyncInterval)
+	}
+
+	return interval, nil
+}
+
+// ReloadInterval reads the behavior_sync_interval config row and applies it
+// to the running service, falling back to the default interval if the row is
+// missing or invalid
+func (s *SyncService) ReloadInterval() {
+	interval := s.defaultInterval
+
+	value, err := GetConfigValue(s.app, BehaviorSyncIntervalConfigName)
+	switch {
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		log.Printf("Error reading behaviour sync interval, using default %s: %v", s.defaultInterval, err)
+	case strings.TrimSpace(value) != "":
+		if configured, err := ValidateSyncInterval(value); err != nil {
+			fmt.Printf("ERROR: %v, using default %s\n", err, s.defaultInterval)
+		} else {
+			interval = configured
+		}
+	}
+
+	s.SetInterval(interval)
+}
+
+// SetInterval changes how often the service syncs. A running service syncs
+// next one interval from now.
+func (s *SyncService) SetInterval(interval time.Duration) {
+	s.intervalMu.Lock()
+	defer s.intervalMu.Unlock()
+
+	if interval == s.interval {
+		return
+	}
+	s.interval = interval
+
+	// Replace any change the ticker has not picked up yet
+	select {
+	case <-s.intervalChanged:
+	default:
+	}
+	s.intervalChanged <- interval
+}
+
+func (s *SyncService) currentInterval() time.Duration {
+	s.intervalMu.Lock()
+	defer s.intervalMu.Unlock()
+
+	return s.interval
+}
+
+// EnableReconciliation makes the service check for notes deleted in ManageBac
+// at most once every interval, comparing notes created within lookback
+func (s *SyncService) EnableReconciliation(every time.Duration, lookback time.Duration) {
+	s.reconcileEvery = every
+	s.reconcileLookback = lookback
+}
+
+// EnableParentNotifications makes the service email parents about upcoming
+// detentions visible to them after each sync
+func (s *SyncService) EnableParentNotifications() {
+	s.notifyParents = true
+}
+
+// Start runs a sync immediately and then every interval until ctx is done or
+// Stop is called. Scheduled syncs are skipped on non-teaching days.
+func (s *SyncService) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.ctx = ctx
+	s.done = make(chan struct{})
+
+	s.ReloadInterval()
+	interval := s.currentInterval()
+
+	fmt.Printf("CRON::BEHAVIOUR_NOTES Starting sync service with interval %s\n", interval)
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if s.isTeachingDay() {
+				if _, err := s.RunNow(ctx, SyncTriggerScheduled); err != nil && !errors.Is(err, ErrSyncInProgress) {
+					log.Printf("Error syncing behavior notes: %v", err)
+				}
+			}
+
+			// Wait for the next tick, resetting the ticker if the interval changes
+		wait:
+			for {
+				select {
+				case <-ctx.Done():
+					fmt.Println("CRON::BEHAVIOUR_NOTES Sync service stopped")
+					return
+				case interval := <-s.intervalChanged:
+					fmt.Printf("CRON::BEHAVIOUR_NOTES Sync interval changed to %s\n", interval)
+					ticker.Reset(interval)
+				case <-ticker.C:
+					break wait
+				}
+			}
+		}
+	}()
+}
+
+// isTeachingDay checks the school calendar before a scheduled sync. Manual
+// syncs run on any day.
+func (s *SyncService) isTeachingDay() bool {
+	teaching, err := IsTeachingDay(s.app, time.Now())
+	if err != nil {
+		log.Printf("Error checking school calendar, syncing anyway: %v", err)
+		return true
+	}
+
+	// Only log the first skipped run of each day
+	if today := time.Now().UTC().Format("2006-01-02"); !teaching && s.skippedDay != today {
+		fmt.Println("CRON::BEHAVIOUR_NOTES Not a teaching day, skipping scheduled syncs")
+		s.skippedDay = today
+	}
+
+	return teaching
+}
+
+// Stop cancels any in-flight sync, scheduled or manual, and waits for the
+// service to shut down
+func (s *SyncService) Stop() {
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	<-s.done
+
+	// Wait for a manual run to finish cancelling
+	s.running.Lock()
+	s.running.Unlock()
+}
+
+// RunManual performs a sync started from the API. It runs detached from the
+// request so closing the page does not cancel it halfway, but is cancelled by
+// Stop and after ManualSyncTimeout.
+func (s *SyncService) RunManual() (*SyncResult, error) {
+	parent := s.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	ctx, cancel := context.WithTimeout(parent, ManualSyncTimeout)
+	defer cancel()
+
+	return s.RunNow(ctx, SyncTriggerManual)
+}
+
+// RunNow performs a sync immediately. It returns ErrSyncInProgress without
+// doing anything if another run has not finished yet.
+func (s *SyncService) RunNow(ctx context.Context, trigger string) (*SyncResult, error) {
+	if !s.running.TryLock() {
+		return nil, ErrSyncInProgress
+	}
+	defer s.running.Unlock()
+
+	result := &SyncResult{
+		Trigger:   trigger,
+		Status:    SyncStatusRunning,
+		StartedAt: time.Now(),
+	}
+
+	runRecord := s.startRun(result)
+
+	err := s.sync(ctx, result)
+
+	if err == nil && s.reconcileEvery > 0 && time.Since(s.lastReconciledAt) >= s.reconcileEvery {
+		s.reconcile(ctx, result)
+	}
+
+	result.FinishedAt = time.Now()
+	if err != nil {
+		result.Status = SyncStatusFailed
+		result.Error = err.Error()
+	} else {
+		result.Status = SyncStatusSuccess
+	}
+
+	s.finishRun(runRecord, result)
+
+	return result, err
+}
+
+func (s *SyncService) sync(ctx context.Context, result *SyncResult) error {
+	modifiedSince, err := GetConfigValue(s.app, LastBehaviorSyncConfigName)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("could not fetch latest edit time: %w", err)
+	}
+	result.ModifiedSince = modifiedSince
+
+	fmt.Printf("CRON::BEHAVIOUR_NOTES Last modified %s\n", modifiedSince)
+
+	resp, err := FetchBehaviorNotes(ctx, s.client, modifiedSince)
+	if errors.Is(err, managebac.ErrCircuitOpen) {
+		fmt.Println("CRON::BEHAVIOUR_NOTES ManageBac is unavailable, skipping sync until the circuit breaker closes")
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching behavior notes: %w", err)
+	}
+
+	result.FetchedCount = len(resp.BehaviorNotes)
+	fmt.Printf("CRON::BEHAVIOUR_NOTES Fetched %d behavior notes\n", result.FetchedCount)
+
+	saved, saveErr := SaveBehaviorNotes(s.app, resp.BehaviorNotes)
+	result.SavedCount = saved
+	result.FailedCount = result.FetchedCount - saved
+
+	logDetentionAlerts(s.app)
+
+	if s.notifyParents {
+		if err := NotifyParents(ctx, s.app, s.client); err != nil {
+			log.Printf("Error notifying parents of detentions: %v", err)
+		}
+	}
+
+	// Only advance the sync cursor once every page has been saved,
+	// otherwise the failed notes would never be fetched again
+	if saveErr != nil {
+		fmt.Println("CRON::BEHAVIOUR_NOTES Not advancing last_behavior_sync_datetime as some notes failed to save")
+		return fmt.Errorf("error saving behavior notes: %w", saveErr)
+	}
+
+	// A full sync links every legacy row that still exists in ManageBac, so
+	// rows left without a ManageBac ID are duplicates
+	if modifiedSince == "" {
+		flagged, err := FlagUnlinkedBehaviorNotes(s.app)
+		if err != nil {
+			log.Printf("Error flagging unlinked behavior notes: %v", err)
+		}
+		result.DeletedCount += flagged
+	}
+
+	// Use the time the run started so notes edited while the sync was in
+	// flight are picked up by the next run
+	if err := SetConfigValue(s.app, LastBehaviorSyncConfigName, result.StartedAt.Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("could not save new modified_since param: %w", err)
+	}
+
+	return nil
+}
+
+// reconcile flags notes deleted in ManageBac. A failed pass is logged and
+// retried on the next run rather than failing the sync.
+func (s *SyncService) reconcile(ctx context.Context, result *SyncResult) {
+	deleted, err := ReconcileDeletedBehaviorNotes(ctx, s.app, s.client, s.reconcileLookback)
+	if err != nil {
+		log.Printf("Error reconciling deleted behavior notes: %v", err)
+		return
+	}
+
+	result.DeletedCount = deleted
+	s.lastReconciledAt = time.Now()
+}
+
+// logDetentionAlerts reports pending detentions and new escalations after a sync
+func logDetentionAlerts(app *pocketbase.PocketBase) {
+	// After saving behavior notes, check for new detentions in rolling 7-day window
+	detentionNotes, err := GetDetentionNotes(app)
+	if err != nil {
+		log.Printf("Error checking detention notes: %v", err)
+	} else if len(detentionNotes) > 0 {
+		fmt.Printf("CRON::BEHAVIOUR_NOTES Found %d pending detentions in 7-day window\n", len(detentionNotes))
+	}
+
+	// Open escalations for students who have reached a policy threshold
+	escalations, err := EvaluateEscalations(app, time.Now())
+	if err != nil {
+		log.Printf("Error evaluating escalations: %v", err)
+	} else if len(escalations) > 0 {
+		fmt.Printf("CRON::BEHAVIOUR_NOTES ALERT: Opened %d escalations\n", len(escalations))
+	}
+}
+
+// startRun creates the behavior_sync_runs record for a run. Failing to record
+// history never stops the sync itself.
+func (s *SyncService) startRun(result *SyncResult) *models.Record {
+	collection, err := s.app.Dao().FindCollectionByNameOrId("behavior_sync_runs")
+	if err != nil {
+		log.Printf("Error finding behavior_sync_runs collection: %v", err)
+		return nil
+	}
+
+	record := models.NewRecord(collection)
+	record.Set("trigger", result.Trigger)
+	record.Set("status", result.Status)
+	startedAt, _ := types.ParseDateTime(result.StartedAt)
+	record.Set("started_at", startedAt)
+
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		log.Printf("Error saving behavior sync run: %v", err)
+		return nil
+	}
+
+	result.RunID = record.Id
+
+	return record
+}
+
+func (s *SyncService) finishRun(record *models.Record, result *SyncResult) {
+	if record == nil {
+		return
+	}
+
+	finishedAt, _ := types.ParseDateTime(result.FinishedAt)
+
+	record.Set("status", result.Status)
+	record.Set("finished_at", finishedAt)
+	record.Set("modified_since", result.ModifiedSince)
+	record.Set("fetched_count", result.FetchedCount)
+	record.Set("saved_count", result.SavedCount)
+	record.Set("failed_count", result.FailedCount)
+	record.Set("deleted_count", result.DeletedCount)
+	record.Set("error", result.Error)
+
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		log.Printf("Error saving behavior sync run: %v", err)
+	}
+}
@@ -1,162 +1,153 @@
 package tasks
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
-	"net/http"
-	"net/url"
-	"strings"
+	"strconv"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/veritymedia/massolit/pocketbase/managebac"
 )
 
-// BehaviorNote represents the structure of behavior notes from ManageBac
-type BehaviorNote struct {
-	ID                int    `json:"id"`
-	StudentID         string `json:"student_id"`
-	FirstName         string `json:"first_name"`
-	LastName          string `json:"last_name"`
-	Email             string `json:"email"`
-	Grade             string `json:"grade"`
-	IncidentTime      string `json:"incident_time"`
-	BehaviorType      string `json:"behavior_type"`
-	Notes             string `json:"notes"`
-	NextStep          string `json:"next_step"`
-	NextStepDate      string `json:"next_step_date"`
-	AuthorID          int    `json:"author_id"` // Keep as int for ManageBac API
-	ReportedBy        string `json:"reported_by"`
-	HomeRoomAdvisor   string `json:"homeroom_advisor"`
-	VisibleToParents  bool   `json:"visible_to_parents"` // Keep as bool for ManageBac API
-	VisibleToStudents bool   `json:"visible_to_students"` // Keep as bool for ManageBac API
-	CreatedAt         string `json:"created_at"`
-	UpdatedAt         string `json:"updated_at"`
-	ActionComplete    bool   `json:"action_complete"`
-}
-
-// ManageBacResponse represents the full API response
-type ManageBacResponse struct {
-	BehaviorNotes []BehaviorNote `json:"behavior_notes"`
-	Meta          struct {
-		CurrentPage int `json:"current_page"`
-		TotalPages  int `json:"total_pages"`
-		TotalCount  int `json:"total_count"`
-		PerPage     int `json:"per_page"`
-	} `json:"meta"`
-}
+// BehaviorNote is the ManageBac behavior note as stored in behavior_notes
+type BehaviorNote = managebac.BehaviorNote
 
-// fetchBehaviorNotes retrieves behavior notes from ManageBac API
-func FetchBehaviorNotes(authToken string, modifiedSince string, managebacUrl string) (*ManageBacResponse, error) {
+// FetchBehaviorNotes retrieves every page of behavior notes from ManageBac API
+// and aggregates them into a single response
+func FetchBehaviorNotes(ctx context.Context, client *managebac.Client, modifiedSince string) (*managebac.BehaviorNotesResponse, error) {
 	fmt.Println("CRON::BEHAVIOUR_NOTES::FETCH_BEHAVIOUR_NOTES")
 
-	resource := "/v2/behavior/notes"
-
-	queryParams := []string{}
-	var rawQuery string
-
-	if modifiedSince != "" {
-		queryParams = append(queryParams, fmt.Sprintf("modified_since=%s", url.PathEscape(modifiedSince)))
+	aggregated := &managebac.BehaviorNotesResponse{}
+	opts := managebac.BehaviorNoteListOptions{
+		ListOptions:   managebac.ListOptions{Page: 1, PerPage: 150},
+		ModifiedSince: modifiedSince,
 	}
 
-	queryParams = append(queryParams, "per_page=150")
+	for {
+		pageResp, err := client.ListBehaviorNotes(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching page %d: %w", opts.Page, err)
+		}
 
-	rawQuery = strings.Join(queryParams, "&")
+		aggregated.BehaviorNotes = append(aggregated.BehaviorNotes, pageResp.BehaviorNotes...)
+		aggregated.Meta = pageResp.Meta
 
-	u, _ := url.ParseRequestURI(managebacUrl)
-	u.Path = resource
-	u.RawQuery = rawQuery
-	qualifiedUrl := fmt.Sprintf("%v", u)
+		fmt.Printf("CRON::BEHAVIOUR_NOTES::FETCH_BEHAVIOUR_NOTES Page %d/%d (%d notes)\n",
+			pageResp.Meta.CurrentPage, pageResp.Meta.TotalPages, len(pageResp.BehaviorNotes))
 
-	req, err := http.NewRequest(http.MethodGet, qualifiedUrl, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %v", err)
-	}
-
-	req.Header.Set("auth-token", authToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error sending request: %v", err)
-	}
-	defer resp.Body.Close()
+		// Stop once ManageBac reports no further pages. An empty page is also
+		// treated as the end to guard against inconsistent meta data.
+		if !pageResp.Meta.HasNextPage() || len(pageResp.BehaviorNotes) == 0 {
+			break
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status code %d", resp.StatusCode)
+		opts.Page = pageResp.Meta.CurrentPage + 1
 	}
 
-	var manageBacResp ManageBacResponse
-	err = json.NewDecoder(resp.Body).Decode(&manageBacResp)
-	if err != nil {
-		return nil, fmt.Errorf("error decoding response: %v", err)
-	}
+	aggregated.Meta.CurrentPage = 1
+	aggregated.Meta.PerPage = len(aggregated.BehaviorNotes)
 
-	return &manageBacResp, nil
+	return aggregated, nil
 }
 
-func SaveBehaviorNotes(app *pocketbase.PocketBase, notes []BehaviorNote) error {
+// SaveBehaviorNotes stores the given notes in the behavior_notes collection
+// and returns how many were saved. Every note is attempted, but an error is
+// returned if any of them failed to save so callers know not to advance the
+// sync cursor.
+func SaveBehaviorNotes(app *pocketbase.PocketBase, notes []BehaviorNote) (int, error) {
 	fmt.Println("CRON::BEHAVIOUR_NOTES::SAVE_BEHAVIOUR_NOTES")
 	collection, err := app.Dao().FindCollectionByNameOrId("behavior_notes")
 	if err != nil {
-		return fmt.Errorf("collection not found: %v", err)
+		return 0, fmt.Errorf("collection not found: %v", err)
 	}
 
+	failed := 0
 	for _, note := range notes {
-		// Check if note already exists by ManageBac ID stored in a custom field
-		// Since we don't have managebac_id field, we'll check by a combination of fields
-		existingRecords, err := app.Dao().FindRecordsByFilter(
-			collection.Name,
-			fmt.Sprintf("student_id = '%s' && incident_time = '%s' && notes = '%s'", 
-				note.StudentID, note.IncidentTime, note.Notes),
-			"",
-			1,
-			0,
-		)
-		
-		var existingNote *models.Record
-		if err == nil && len(existingRecords) > 0 {
-			existingNote = existingRecords[0]
-			err = nil
-		} else {
-			err = fmt.Errorf("record not found")
-		}
-
+		record, err := findExistingBehaviorNote(app, note)
 		if err != nil {
 			// Create new record if not exists
-			record := models.NewRecord(collection)
-			// Don't set managebac_id since it doesn't exist in schema
-			record.Set("student_id", note.StudentID)
-			record.Set("first_name", note.FirstName)
-			record.Set("last_name", note.LastName)
-			record.Set("email", note.Email)
-			record.Set("grade", note.Grade)
-			record.Set("incident_time", note.IncidentTime)
-			record.Set("behavior_type", note.BehaviorType)
-			record.Set("notes", note.Notes)
-			record.Set("next_step", note.NextStep)
-			record.Set("next_step_date", note.NextStepDate)
-			// Convert ManageBac data types to match database schema
-			record.Set("author_id", fmt.Sprintf("%d", note.AuthorID)) // Convert int to string
-			record.Set("reported_by", note.ReportedBy)
-			record.Set("homeroom_advisor", note.HomeRoomAdvisor)
-			record.Set("visible_to_parents", fmt.Sprintf("%t", note.VisibleToParents)) // Convert bool to string
-			record.Set("visible_to_students", fmt.Sprintf("%t", note.VisibleToStudents)) // Convert bool to string
-			record.Set("created_at", note.CreatedAt)
-			record.Set("updated_at", note.UpdatedAt)
-
-			if err := app.Dao().Save(record); err != nil {
-				log.Printf("Error saving record: %v", err)
-			}
-		} else {
-			// Update existing record
-			existingNote.Set("updated_at", note.UpdatedAt)
-
-			if err := app.Dao().Save(existingNote); err != nil {
-				log.Printf("Error updating record: %v", err)
-			}
+			record = models.NewRecord(collection)
 		}
+
+		setBehaviorNoteFields(record, note)
+
+		if err := app.Dao().Save(record); err != nil {
+			log.Printf("Error saving record for ManageBac note %d: %v", note.ID, err)
+			failed++
+		}
+	}
+
+	saved := len(notes) - failed
+	if failed > 0 {
+		return saved, fmt.Errorf("failed to save %d of %d behavior notes", failed, len(notes))
+	}
+
+	return saved, nil
+}
+
+// findExistingBehaviorNote looks up the stored copy of a ManageBac note by its
+// ManageBac ID. Rows saved before managebac_id existed are matched on their
+// original content instead so they can be linked to their ManageBac ID.
+func findExistingBehaviorNote(app *pocketbase.PocketBase, note BehaviorNote) (*models.Record, error) {
+	record, err := app.Dao().FindFirstRecordByData("behavior_notes", "managebac_id", strconv.Itoa(note.ID))
+	if err == nil {
+		return record, nil
+	}
+
+	incidentTime, _ := types.ParseDateTime(note.IncidentTime)
+
+	return app.Dao().FindFirstRecordByFilter(
+		"behavior_notes",
+		"managebac_id = '' && student_id = {:studentId} && incident_time = {:incidentTime} && notes = {:notes}",
+		dbx.Params{
+			"studentId":    note.StudentID,
+			"incidentTime": incidentTime.String(),
+			"notes":        note.Notes,
+		},
+	)
+}
+
+// setBehaviorNoteFields copies every ManageBac field onto the record so that
+// edits made in ManageBac are fully reflected locally
+func setBehaviorNoteFields(record *models.Record, note BehaviorNote) {
+	record.Set("managebac_id", strconv.Itoa(note.ID))
+	record.Set("student_id", note.StudentID)
+	record.Set("first_name", note.FirstName)
+	record.Set("last_name", note.LastName)
+	record.Set("email", note.Email)
+	record.Set("grade", note.Grade)
+	record.Set("behavior_type", note.BehaviorType)
+	record.Set("notes", note.Notes)
+	record.Set("next_step", note.NextStep)
+	// Convert ManageBac data types to match database schema
+	record.Set("author_id", fmt.Sprintf("%d", note.AuthorID)) // Convert int to string
+	record.Set("reported_by", note.ReportedBy)
+	record.Set("homeroom_advisor", note.HomeRoomAdvisor)
+	record.Set("visible_to_parents", note.VisibleToParents)
+	record.Set("visible_to_students", note.VisibleToStudents)
+	// ManageBac sends RFC3339 timestamps (and plain dates for next_step_date),
+	// these are normalised to UTC date fields
+	setBehaviorNoteDate(record, "incident_time", note.IncidentTime)
+	setBehaviorNoteDate(record, "next_step_date", note.NextStepDate)
+	setBehaviorNoteDate(record, "created_at", note.CreatedAt)
+	setBehaviorNoteDate(record, "updated_at", note.UpdatedAt)
+	// A note returned by ManageBac exists upstream, so undo any earlier
+	// deletion flag set by ReconcileDeletedBehaviorNotes
+	record.Set("deleted_at", "")
+}
+
+// setBehaviorNoteDate stores a ManageBac timestamp in a date field, clearing
+// the field if the value cannot be parsed
+func setBehaviorNoteDate(record *models.Record, field string, value string) {
+	date, err := types.ParseDateTime(value)
+	if err != nil {
+		log.Printf("Could not parse %s '%s' for ManageBac note %s: %v", field, value, record.GetString("managebac_id"), err)
+		date = types.DateTime{}
 	}
 
-	return nil
+	record.Set(field, date)
 }
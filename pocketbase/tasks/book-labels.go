@@ -0,0 +1,189 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/veritymedia/massolit/pocketbase/labels"
+)
+
+const (
+	// BookCodeVersion is the version of the QR code format printed on labels
+	BookCodeVersion = 1
+
+	// MaxLabelCopies is the most book instances created for one label sheet
+	MaxLabelCopies = 200
+)
+
+var (
+	// ErrInvalidBookCodePrefix is returned for a book code prefix that is empty
+	// or has characters other than letters, digits and hyphens
+	ErrInvalidBookCodePrefix = errors.New("prefix must be letters, digits and hyphens, eg. IG-PSYCH")
+	// ErrInvalidLabelCopies is returned when asking for no copies or too many
+	ErrInvalidLabelCopies = fmt.Errorf("copies must be between 1 and %d", MaxLabelCopies)
+	// ErrBookInstanceNotFound is returned when reprinting labels of a book
+	// instance that does not exist
+	ErrBookInstanceNotFound = errors.New("book instance not found")
+)
+
+var bookCodePrefixPattern = regexp.MustCompile(`^[A-Z0-9]+(-[A-Z0-9]+)*$`)
+
+// BookQRCode returns the content of the QR code identifying a book instance,
+// in the format the scanner reads: MASSOLIT|<version>|<book code>|<isbn>
+func BookQRCode(bookCode string, isbn string) string {
+	return fmt.Sprintf("MASSOLIT|%d|%s|%s", BookCodeVersion, bookCode, isbn)
+}
+
+// BookCodePrefix returns the prefix for new book codes of book: prefix if it
+// is given, otherwise the book's department, upper cased with spaces turned
+// into hyphens
+func BookCodePrefix(book *models.Record, prefix string) (string, error) {
+	if strings.TrimSpace(prefix) == "" {
+		prefix = book.GetString("department")
+	}
+
+	prefix = strings.ToUpper(strings.Join(strings.Fields(prefix), "-"))
+	if !bookCodePrefixPattern.MatchString(prefix) {
+		return "", ErrInvalidBookCodePrefix
+	}
+
+	return prefix, nil
+}
+
+// CreateBookInstances creates copies book instances of book, numbered on
+// from the highest existing book code with prefix, eg. IG-PSYCH-21,
+// IG-PSYCH-22. The instances are created in one transaction so concurrent
+// requests cannot hand out the same code. render is called with the new
+// instances before the transaction commits, so if their labels cannot be
+// printed no instances are created.
+func CreateBookInstances(app *pocketbase.PocketBase, book *models.Record, prefix string, copies int, render func([]*models.Record) error) ([]*models.Record, error) {
+	if copies < 1 || copies > MaxLabelCopies {
+		return nil, ErrInvalidLabelCopies
+	}
+
+	collection, err := app.Dao().FindCollectionByNameOrId("book_instances")
+	if err != nil {
+		return nil, fmt.Errorf("error finding book_instances collection: %v", err)
+	}
+
+	var instances []*models.Record
+	err = app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		next, err := nextBookCodeNumber(txDao, prefix)
+		if err != nil {
+			return err
+		}
+
+		instances = make([]*models.Record, 0, copies)
+		for i := 0; i < copies; i++ {
+			record := models.NewRecord(collection)
+			record.Set("book", book.Id)
+			record.Set("book_code", fmt.Sprintf("%s-%d", prefix, next+i))
+
+			if err := txDao.SaveRecord(record); err != nil {
+				return fmt.Errorf("error creating book instance %s: %v", record.GetString("book_code"), err)
+			}
+			instances = append(instances, record)
+		}
+
+		return render(instances)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return instances, nil
+}
+
+// nextBookCodeNumber returns the number following the highest book code of
+// the form <prefix>-<number>
+func nextBookCodeNumber(dao *daos.Dao, prefix string) (int, error) {
+	var codes []string
+	err := dao.DB().Select("book_code").
+		From("book_instances").
+		Where(dbx.Like("book_code", prefix+"-").Match(false, true)).
+		Column(&codes)
+	if err != nil {
+		return 0, fmt.Errorf("error querying book codes: %v", err)
+	}
+
+	highest := 0
+	for _, code := range codes {
+		number, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(code), prefix+"-"))
+		if err != nil {
+			// Longer prefixes sharing this one, eg. IG-PSYCH-HL-1
+			continue
+		}
+		highest = max(highest, number)
+	}
+
+	return highest + 1, nil
+}
+
+// BookLabels returns the labels for book instances of book
+func BookLabels(book *models.Record, instances []*models.Record) []labels.Label {
+	isbn := book.GetString("isbn")
+	if isbn == "0" {
+		isbn = ""
+	}
+
+	result := make([]labels.Label, 0, len(instances))
+	for _, instance := range instances {
+		code := instance.GetString("book_code")
+		result = append(result, labels.Label{
+			QR:    BookQRCode(code, isbn),
+			Title: book.GetString("title"),
+			Code:  code,
+			ISBN:  isbn,
+		})
+	}
+
+	return result
+}
+
+// BookInstanceLabels returns the labels for existing book instances, in the
+// order of ids, so lost or damaged labels can be printed again
+func BookInstanceLabels(app *pocketbase.PocketBase, ids []string) ([]labels.Label, error) {
+	if len(ids) < 1 || len(ids) > MaxLabelCopies {
+		return nil, ErrInvalidLabelCopies
+	}
+
+	instances, err := app.Dao().FindRecordsByIds("book_instances", ids)
+	if err != nil {
+		return nil, fmt.Errorf("error finding book instances: %v", err)
+	}
+
+	byID := make(map[string]*models.Record, len(instances))
+	for _, instance := range instances {
+		byID[instance.Id] = instance
+	}
+
+	books := map[string]*models.Record{}
+	result := make([]labels.Label, 0, len(ids))
+	for _, id := range ids {
+		instance, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrBookInstanceNotFound, id)
+		}
+
+		bookID := instance.GetString("book")
+		book, ok := books[bookID]
+		if !ok {
+			book, err = app.Dao().FindRecordById("books", bookID)
+			if err != nil {
+				return nil, fmt.Errorf("error finding book of instance %s: %v", id, err)
+			}
+			books[bookID] = book
+		}
+
+		result = append(result, BookLabels(book, []*models.Record{instance})...)
+	}
+
+	return result, nil
+}
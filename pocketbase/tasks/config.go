@@ -0,0 +1,67 @@
+package tasks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// GetConfigValue returns the value of the named row in the config collection
+func GetConfigValue(app *pocketbase.PocketBase, name string) (string, error) {
+	record, err := app.Dao().FindFirstRecordByFilter("config", "name = {:name}", dbx.Params{"name": name})
+	if err != nil {
+		return "", fmt.Errorf("could not find config %s: %w", name, err)
+	}
+
+	return record.GetString("value"), nil
+}
+
+// SetConfigValue stores value in the named row of the config collection,
+// creating the row if it does not exist yet
+func SetConfigValue(app *pocketbase.PocketBase, name string, value string) error {
+	record, err := app.Dao().FindFirstRecordByFilter("config", "name = {:name}", dbx.Params{"name": name})
+	if err != nil {
+		collection, err := app.Dao().FindCollectionByNameOrId("config")
+		if err != nil {
+			return fmt.Errorf("collection not found: %v", err)
+		}
+
+		record = models.NewRecord(collection)
+		record.Set("name", name)
+	}
+
+	record.Set("value", value)
+
+	if err := app.Dao().SaveRecord(record); err != nil {
+		return fmt.Errorf("could not save config %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// GetConfigInt returns the named config row as a positive number, or fallback
+// if the row is missing or invalid
+func GetConfigInt(app *pocketbase.PocketBase, name string, fallback int) int {
+	value, err := GetConfigValue(app, name)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error reading config %s, using %d: %v", name, fallback, err)
+		}
+		return fallback
+	}
+
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || number <= 0 {
+		fmt.Printf("ERROR: Invalid value '%s' for config %s, using %d\n", value, name, fallback)
+		return fallback
+	}
+
+	return number
+}
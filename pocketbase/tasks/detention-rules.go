@@ -0,0 +1,128 @@
+package tasks
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+)
+
+// DetentionRule decides which behaviour notes count as detentions. A note
+// matches when its match_field contains pattern (case-insensitive, "%" may be
+// used as a wildcard). Rules are checked in priority order, lowest first.
+type DetentionRule struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	MatchField      string  `json:"match_field"`
+	Pattern         string  `json:"pattern"`
+	Category        string  `json:"category"`
+	Severity        float64 `json:"severity"`
+	IncludeInReport bool    `json:"include_in_report"`
+	Priority        int     `json:"priority"`
+}
+
+// DetentionRules is the set of active rules loaded from detention_rules,
+// sorted by priority
+type DetentionRules []DetentionRule
+
+// LoadDetentionRules returns the active rows of the detention_rules collection
+func LoadDetentionRules(app *pocketbase.PocketBase) (DetentionRules, error) {
+	records, err := app.Dao().FindRecordsByFilter("detention_rules", "active = true", "priority,created", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error loading detention rules: %v", err)
+	}
+
+	rules := DetentionRules{}
+	for _, record := range records {
+		field := record.GetString("match_field")
+		if field != "next_step" && field != "behavior_type" {
+			continue
+		}
+
+		rules = append(rules, DetentionRule{
+			ID:              record.Id,
+			Name:            record.GetString("name"),
+			MatchField:      field,
+			Pattern:         record.GetString("pattern"),
+			Category:        record.GetString("category"),
+			Severity:        record.GetFloat("severity"),
+			IncludeInReport: record.GetBool("include_in_report"),
+			Priority:        record.GetInt("priority"),
+		})
+	}
+
+	return rules, nil
+}
+
+// Reportable returns the rules whose detentions are listed in reports
+func (rules DetentionRules) Reportable() DetentionRules {
+	reportable := DetentionRules{}
+	for _, rule := range rules {
+		if rule.IncludeInReport {
+			reportable = append(reportable, rule)
+		}
+	}
+
+	return reportable
+}
+
+// Filter builds a record filter matching any of the rules. It returns false if
+// there are no rules, in which case nothing should be queried.
+func (rules DetentionRules) Filter() (string, dbx.Params, bool) {
+	if len(rules) == 0 {
+		return "", nil, false
+	}
+
+	conditions := make([]string, 0, len(rules))
+	params := dbx.Params{}
+	for i, rule := range rules {
+		name := fmt.Sprintf("rule%d", i)
+		conditions = append(conditions, fmt.Sprintf("%s ~ {:%s}", rule.MatchField, name))
+		params[name] = rule.Pattern
+	}
+
+	return "(" + strings.Join(conditions, " || ") + ")", params, true
+}
+
+// Match returns the first rule, in priority order, that applies to note, or
+// nil if none do
+func (rules DetentionRules) Match(note BehaviorNote) *DetentionRule {
+	for i, rule := range rules {
+		value := note.NextStep
+		if rule.MatchField == "behavior_type" {
+			value = note.BehaviorType
+		}
+
+		if likeMatch(value, rule.Pattern) {
+			return &rules[i]
+		}
+	}
+
+	return nil
+}
+
+// Classify tags note with the category and severity of the rule that applies
+// to it, if any
+func (rules DetentionRules) Classify(note *DetentionNote) {
+	if rule := rules.Match(note.BehaviorNote); rule != nil {
+		note.Category = rule.Category
+		note.Severity = rule.Severity
+	}
+}
+
+// likeMatch mirrors the PocketBase "~" operator: a case-insensitive contains
+// check, where "%" matches any run of characters
+func likeMatch(value string, pattern string) bool {
+	value = strings.ToLower(value)
+
+	for _, part := range strings.Split(strings.ToLower(pattern), "%") {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+
+	return true
+}
@@ -0,0 +1,169 @@
+package tasks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	EmailTypeDetentionReport     = "detention_report"
+	EmailTypeDetentionReportTest = "detention_report_test"
+	EmailTypeWeeklySummary       = "weekly_summary"
+	EmailTypeTermlySummary       = "termly_summary"
+	EmailTypeParentDetention     = "parent_detention"
+	EmailTypeAdvisorDigest       = "advisor_digest"
+	EmailTypeOverdueReminder     = "overdue_reminder"
+	EmailTypeOverdueReport       = "overdue_report"
+
+	EmailStatusSent   = "sent"
+	EmailStatusFailed = "failed"
+)
+
+var (
+	// ErrEmailNotFailed is returned when trying to re-send an email that was sent
+	ErrEmailNotFailed = errors.New("only failed emails can be re-sent")
+	// ErrEmailAlreadyResent is returned when a failed email has since been
+	// re-sent successfully
+	ErrEmailAlreadyResent = errors.New("this email has already been re-sent")
+)
+
+// sendEmail sends message and records the attempt in email_log. reportType
+// identifies the kind of email, eg. EmailTypeDetentionReport.
+func sendEmail(app *pocketbase.PocketBase, reportType string, message *mailer.Message) error {
+	return sendLoggedEmail(app, reportType, message, "")
+}
+
+func sendLoggedEmail(app *pocketbase.PocketBase, reportType string, message *mailer.Message, resendOf string) error {
+	sendErr := app.NewMailClient().Send(message)
+
+	logEmail(app, reportType, message, resendOf, sendErr)
+
+	return sendErr
+}
+
+// logEmail saves an email_log record. Failing to record the email is logged
+// rather than returned, as the email itself has already been handled.
+func logEmail(app *pocketbase.PocketBase, reportType string, message *mailer.Message, resendOf string, sendErr error) {
+	collection, err := app.Dao().FindCollectionByNameOrId("email_log")
+	if err != nil {
+		log.Printf("Error finding email_log collection: %v", err)
+		return
+	}
+
+	recipients := make([]string, 0, len(message.To))
+	for _, address := range message.To {
+		recipients = append(recipients, address.Address)
+	}
+
+	hash := sha256.Sum256([]byte(message.HTML + message.Text))
+	sentAt, _ := types.ParseDateTime(time.Now())
+
+	record := models.NewRecord(collection)
+	record.Set("report_type", reportType)
+	record.Set("recipients", recipients)
+	record.Set("subject", message.Subject)
+	record.Set("body_hash", hex.EncodeToString(hash[:]))
+	record.Set("html", message.HTML)
+	record.Set("text", message.Text)
+	record.Set("sent_at", sentAt)
+	record.Set("resend_of", resendOf)
+
+	if sendErr != nil {
+		record.Set("status", EmailStatusFailed)
+		record.Set("error", sendErr.Error())
+	} else {
+		record.Set("status", EmailStatusSent)
+	}
+
+	if err := app.Dao().SaveRecord(record); err != nil {
+		log.Printf("Error saving email log: %v", err)
+	}
+}
+
+// hasReceivedEmail reports whether an email of reportType was sent to email on
+// the (UTC) calendar day of day
+func hasReceivedEmail(app *pocketbase.PocketBase, email string, reportType string, day time.Time) (bool, error) {
+	from, to := dayRange(day)
+
+	records, err := app.Dao().FindRecordsByFilter(
+		"email_log",
+		"report_type = {:type} && status = {:status} && sent_at >= {:from} && sent_at < {:to} && recipients ~ {:email}",
+		"",
+		1,
+		0,
+		dbx.Params{
+			"type":   reportType,
+			"status": EmailStatusSent,
+			"from":   from.String(),
+			"to":     to.String(),
+			"email":  `"` + email + `"`,
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return len(records) > 0, nil
+}
+
+// ResendFailedEmail sends a failed email again from its email_log record. The
+// new attempt is logged as a separate record linked to the original.
+func ResendFailedEmail(app *pocketbase.PocketBase, id string) error {
+	record, err := app.Dao().FindRecordById("email_log", id)
+	if err != nil {
+		return fmt.Errorf("error finding email log %s: %w", id, err)
+	}
+
+	if record.GetString("status") != EmailStatusFailed {
+		return ErrEmailNotFailed
+	}
+
+	resent, err := app.Dao().FindRecordsByFilter(
+		"email_log",
+		"resend_of = {:id} && status = {:status}",
+		"",
+		1,
+		0,
+		dbx.Params{"id": record.Id, "status": EmailStatusSent},
+	)
+	if err != nil {
+		return fmt.Errorf("error checking re-sends of email log %s: %v", id, err)
+	}
+	if len(resent) > 0 {
+		return ErrEmailAlreadyResent
+	}
+
+	var recipients []string
+	if err := record.UnmarshalJSONField("recipients", &recipients); err != nil {
+		return fmt.Errorf("error reading recipients of email log %s: %v", id, err)
+	}
+
+	to := make([]mail.Address, 0, len(recipients))
+	for _, recipient := range recipients {
+		to = append(to, mail.Address{Address: recipient})
+	}
+
+	message := &mailer.Message{
+		From: mail.Address{
+			Address: app.Settings().Meta.SenderAddress,
+			Name:    app.Settings().Meta.SenderName,
+		},
+		To:      to,
+		Subject: record.GetString("subject"),
+		HTML:    record.GetString("html"),
+		Text:    record.GetString("text"),
+	}
+
+	return sendLoggedEmail(app, record.GetString("report_type"), message, record.Id)
+}
@@ -0,0 +1,139 @@
+package tasks
+
+import (
+	"bytes"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// defaultEmailTemplates holds the built-in email templates. Each template has
+// an HTML part (<name>.html) and a plain text part (<name>.txt).
+//
+//go:embed templates
+var defaultEmailTemplates embed.FS
+
+// DetentionReportTemplate is the template used for detention report emails
+const DetentionReportTemplate = "detention-report"
+
+// BehaviorSummaryTemplate is the template used for weekly and termly summaries
+const BehaviorSummaryTemplate = "behavior-summary"
+
+// ParentDetentionTemplate is the template used to tell parents of a detention
+const ParentDetentionTemplate = "parent-detention"
+
+// AdvisorDigestTemplate is the template used for homeroom advisor digests
+const AdvisorDigestTemplate = "advisor-digest"
+
+// OverdueReminderTemplate is the template used to remind students of overdue
+// books
+const OverdueReminderTemplate = "overdue-reminder"
+
+// OverdueReportTemplate is the template used for the library overdue list
+const OverdueReportTemplate = "overdue-report"
+
+// emailTemplateFuncs are available in both the HTML and plain text templates
+var emailTemplateFuncs = map[string]any{
+	"even": func(i int) bool { return i%2 == 0 },
+	// signed shows a change with its sign, eg. +2
+	"signed": func(i int) string { return fmt.Sprintf("%+d", i) },
+}
+
+// renderEmail renders the HTML and plain text parts of the named template.
+// A part set on the email_templates row with the same name overrides the
+// built-in one. HTML values are escaped automatically.
+func renderEmail(app *pocketbase.PocketBase, name string, data any) (string, string, error) {
+	htmlSource, textSource, err := loadEmailTemplate(app, name)
+	if err != nil {
+		return "", "", err
+	}
+
+	htmlTmpl, err := htmltemplate.New(name).Funcs(emailTemplateFuncs).Parse(htmlSource)
+	if err != nil {
+		return "", "", fmt.Errorf("error parsing %s html template: %v", name, err)
+	}
+
+	textTmpl, err := texttemplate.New(name).Funcs(emailTemplateFuncs).Parse(textSource)
+	if err != nil {
+		return "", "", fmt.Errorf("error parsing %s text template: %v", name, err)
+	}
+
+	var html bytes.Buffer
+	if err := htmlTmpl.Execute(&html, data); err != nil {
+		return "", "", fmt.Errorf("error rendering %s html template: %v", name, err)
+	}
+
+	var text bytes.Buffer
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return "", "", fmt.Errorf("error rendering %s text template: %v", name, err)
+	}
+
+	return html.String(), text.String(), nil
+}
+
+// loadEmailTemplate returns the HTML and plain text sources of the named
+// template, preferring the overrides in the email_templates collection
+func loadEmailTemplate(app *pocketbase.PocketBase, name string) (string, string, error) {
+	htmlSource, err := defaultEmailTemplates.ReadFile("templates/" + name + ".html")
+	if err != nil {
+		return "", "", fmt.Errorf("unknown email template %s: %v", name, err)
+	}
+
+	textSource, err := defaultEmailTemplates.ReadFile("templates/" + name + ".txt")
+	if err != nil {
+		return "", "", fmt.Errorf("unknown email template %s: %v", name, err)
+	}
+
+	html, text := string(htmlSource), string(textSource)
+
+	record, err := app.Dao().FindFirstRecordByFilter("email_templates", "name = {:name}", dbx.Params{"name": name})
+	if errors.Is(err, sql.ErrNoRows) {
+		return html, text, nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error loading email template %s: %v", name, err)
+	}
+
+	if override := record.GetString("html"); strings.TrimSpace(override) != "" {
+		html = override
+	}
+
+	if override := record.GetString("text"); strings.TrimSpace(override) != "" {
+		text = override
+	}
+
+	return html, text, nil
+}
+
+// ValidateEmailTemplate checks that an email_templates record refers to a
+// built-in template and that its overrides parse
+func ValidateEmailTemplate(record *models.Record) error {
+	name := record.GetString("name")
+	if _, err := defaultEmailTemplates.ReadFile("templates/" + name + ".html"); err != nil {
+		return fmt.Errorf("unknown email template %s", name)
+	}
+
+	if _, err := htmltemplate.New(name).Funcs(emailTemplateFuncs).Parse(record.GetString("html")); err != nil {
+		return fmt.Errorf("invalid html template: %v", err)
+	}
+
+	if _, err := texttemplate.New(name).Funcs(emailTemplateFuncs).Parse(record.GetString("text")); err != nil {
+		return fmt.Errorf("invalid text template: %v", err)
+	}
+
+	return nil
+}
+
+// appURL returns the application URL configured in the PocketBase settings,
+// without a trailing slash
+func appURL(app *pocketbase.PocketBase) string {
+	return strings.TrimRight(app.Settings().Meta.AppUrl, "/")
+}
@@ -0,0 +1,418 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	EscalationStatusOpen         = "open"
+	EscalationStatusAcknowledged = "acknowledged"
+	EscalationStatusResolved     = "resolved"
+)
+
+// EscalationPolicy is a tier of the pastoral escalation policy. A student is
+// escalated once the total severity of their detentions created within
+// WindowDays reaches Threshold. Only detentions in Categories are counted,
+// or all of them if Categories is empty.
+type EscalationPolicy struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Level      int      `json:"level"`
+	WindowDays int      `json:"window_days"`
+	Threshold  float64  `json:"threshold"`
+	Categories []string `json:"categories"`
+	Action     string   `json:"action"`
+}
+
+// Escalation is a student who triggered an escalation policy
+type Escalation struct {
+	StudentDetentionSummary
+	ID          string    `json:"id"`
+	PolicyID    string    `json:"policy_id"`
+	PolicyName  string    `json:"policy_name"`
+	Level       int       `json:"level"`
+	WindowDays  int       `json:"window_days"`
+	Action      string    `json:"action"`
+	Status      string    `json:"status"`
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// LoadEscalationPolicies returns the active rows of the escalation_policies
+// collection, lowest level first
+func LoadEscalationPolicies(app *pocketbase.PocketBase) ([]EscalationPolicy, error) {
+	records, err := app.Dao().FindRecordsByFilter("escalation_policies", "active = true", "level,created", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error loading escalation policies: %v", err)
+	}
+
+	policies := []EscalationPolicy{}
+	for _, record := range records {
+		policies = append(policies, EscalationPolicy{
+			ID:         record.Id,
+			Name:       record.GetString("name"),
+			Level:      record.GetInt("level"),
+			WindowDays: record.GetInt("window_days"),
+			Threshold:  record.GetFloat("threshold"),
+			Categories: record.GetStringSlice("categories"),
+			Action:     record.GetString("action"),
+		})
+	}
+
+	return policies, nil
+}
+
+// counts reports whether a detention counts towards the policy
+func (policy EscalationPolicy) counts(note DetentionNote) bool {
+	if len(policy.Categories) == 0 {
+		return true
+	}
+
+	for _, category := range policy.Categories {
+		if note.Category == category {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EvaluateEscalations checks every active policy against the detentions in its
+// window and records an open escalation for each student who reaches the
+// threshold. A student is not escalated again under the same policy while an
+// earlier escalation is unresolved, or after it was resolved unless they have
+// received another detention since. It returns the newly opened escalations.
+func EvaluateEscalations(app *pocketbase.PocketBase, now time.Time) ([]Escalation, error) {
+	policies, err := LoadEscalationPolicies(app)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	rules, err := LoadDetentionRules(app)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch the widest window once and narrow it down for each policy
+	longestWindow := 0
+	for _, policy := range policies {
+		if policy.WindowDays > longestWindow {
+			longestWindow = policy.WindowDays
+		}
+	}
+
+	since, _ := types.ParseDateTime(now.AddDate(0, 0, -longestWindow))
+
+	// Count every detention matching any rule, completed or not
+	allDetentions, err := findDetentionNotes(
+		app,
+		rules,
+		false,
+		"deleted_at = '' && created_at >= {:since}",
+		dbx.Params{"since": since.String()},
+		"-created_at",
+		0,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying detention notes for escalations: %v", err)
+	}
+
+	collection, err := app.Dao().FindCollectionByNameOrId("escalations")
+	if err != nil {
+		return nil, fmt.Errorf("error finding escalations collection: %v", err)
+	}
+
+	var opened []Escalation
+	for _, policy := range policies {
+		windowStart := now.AddDate(0, 0, -policy.WindowDays)
+
+		var detentions []DetentionNote
+		for _, detention := range allDetentions {
+			createdAt, err := time.Parse(time.RFC3339, detention.CreatedAt)
+			if err != nil || createdAt.Before(windowStart) || !policy.counts(detention) {
+				continue
+			}
+			detentions = append(detentions, detention)
+		}
+
+		for _, student := range summariseDetentionsByStudent(detentions) {
+			if student.TotalSeverity < policy.Threshold {
+				continue
+			}
+
+			escalate, err := shouldEscalate(app, policy, student)
+			if err != nil {
+				log.Printf("Error checking escalations for student %s: %v", student.StudentID, err)
+				continue
+			}
+			if !escalate {
+				continue
+			}
+
+			escalation, err := openEscalation(app, collection, policy, student, now)
+			if err != nil {
+				log.Printf("Error saving escalation for student %s: %v", student.StudentID, err)
+				continue
+			}
+
+			opened = append(opened, escalation)
+		}
+	}
+
+	fmt.Printf("Opened %d escalations\n", len(opened))
+
+	return opened, nil
+}
+
+// summariseDetentionsByStudent groups detentions by student, totalling the
+// severity of each student's detentions
+func summariseDetentionsByStudent(detentions []DetentionNote) []StudentDetentionSummary {
+	var order []string
+	studentDetentions := make(map[string][]DetentionNote)
+	for _, detention := range detentions {
+		if _, ok := studentDetentions[detention.StudentID]; !ok {
+			order = append(order, detention.StudentID)
+		}
+		studentDetentions[detention.StudentID] = append(studentDetentions[detention.StudentID], detention)
+	}
+
+	summaries := make([]StudentDetentionSummary, 0, len(order))
+	for _, studentID := range order {
+		notes := studentDetentions[studentID]
+
+		weight := 0.0
+		for _, note := range notes {
+			weight += note.Severity
+		}
+
+		summaries = append(summaries, StudentDetentionSummary{
+			StudentID:       studentID,
+			FirstName:       notes[0].FirstName,
+			LastName:        notes[0].LastName,
+			Email:           notes[0].Email,
+			Grade:           notes[0].Grade,
+			HomeRoomAdvisor: notes[0].HomeRoomAdvisor,
+			DetentionCount:  len(notes),
+			TotalSeverity:   weight,
+			DetentionNotes:  notes,
+		})
+	}
+
+	return summaries
+}
+
+// shouldEscalate checks the student's latest escalation under the policy
+func shouldEscalate(app *pocketbase.PocketBase, policy EscalationPolicy, student StudentDetentionSummary) (bool, error) {
+	records, err := app.Dao().FindRecordsByFilter(
+		"escalations",
+		"policy = {:policy} && student_id = {:student}",
+		"-triggered_at",
+		1,
+		0,
+		dbx.Params{"policy": policy.ID, "student": student.StudentID},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	if len(records) == 0 {
+		return true, nil
+	}
+
+	latest := records[0]
+	if latest.GetString("status") != EscalationStatusResolved {
+		return false, nil
+	}
+
+	// Only escalate again for detentions received after the last resolution
+	resolvedAt := latest.GetDateTime("resolved_at").Time()
+	for _, note := range student.DetentionNotes {
+		createdAt, err := time.Parse(time.RFC3339, note.CreatedAt)
+		if err == nil && createdAt.After(resolvedAt) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func openEscalation(app *pocketbase.PocketBase, collection *models.Collection, policy EscalationPolicy, student StudentDetentionSummary, now time.Time) (Escalation, error) {
+	noteIDs := make([]string, 0, len(student.DetentionNotes))
+	for _, note := range student.DetentionNotes {
+		noteIDs = append(noteIDs, note.RecordID)
+	}
+
+	triggeredAt, _ := types.ParseDateTime(now)
+
+	record := models.NewRecord(collection)
+	record.Set("policy", policy.ID)
+	record.Set("status", EscalationStatusOpen)
+	record.Set("student_id", student.StudentID)
+	record.Set("first_name", student.FirstName)
+	record.Set("last_name", student.LastName)
+	record.Set("email", student.Email)
+	record.Set("grade", student.Grade)
+	record.Set("homeroom_advisor", student.HomeRoomAdvisor)
+	record.Set("detention_count", student.DetentionCount)
+	record.Set("total_severity", student.TotalSeverity)
+	record.Set("behavior_notes", noteIDs)
+	record.Set("triggered_at", triggeredAt)
+
+	if err := app.Dao().SaveRecord(record); err != nil {
+		return Escalation{}, err
+	}
+
+	fmt.Printf("  - ESCALATION: %s %s (%s) reached %s with %d detentions in %d days\n",
+		student.FirstName, student.LastName, student.Grade, policy.Name, student.DetentionCount, policy.WindowDays)
+
+	return escalationFromPolicy(record, policy, student), nil
+}
+
+func escalationFromPolicy(record *models.Record, policy EscalationPolicy, student StudentDetentionSummary) Escalation {
+	return Escalation{
+		StudentDetentionSummary: student,
+		ID:                      record.Id,
+		PolicyID:                policy.ID,
+		PolicyName:              policy.Name,
+		Level:                   policy.Level,
+		WindowDays:              policy.WindowDays,
+		Action:                  policy.Action,
+		Status:                  record.GetString("status"),
+		TriggeredAt:             record.GetDateTime("triggered_at").Time(),
+	}
+}
+
+// GetOpenEscalationsSince returns the escalations triggered since the given
+// time that nobody has acknowledged yet, highest level first
+func GetOpenEscalationsSince(app *pocketbase.PocketBase, since time.Time) ([]Escalation, error) {
+	from, _ := types.ParseDateTime(since)
+
+	return findOpenEscalations(app, "triggered_at >= {:since}", dbx.Params{"since": from.String()})
+}
+
+// GetUnreportedEscalations returns the open escalations that have not been
+// in a sent detention report yet, highest level first. Escalations opened on
+// days without a report are picked up by the next one.
+func GetUnreportedEscalations(app *pocketbase.PocketBase) ([]Escalation, error) {
+	return findOpenEscalations(app, "reported_at = ''", dbx.Params{})
+}
+
+// MarkEscalationsReported stamps reported_at on escalations that have been
+// sent in a detention report
+func MarkEscalationsReported(app *pocketbase.PocketBase, ids []string) error {
+	now := types.NowDateTime()
+
+	var errs []error
+	for _, id := range ids {
+		record, err := app.Dao().FindRecordById("escalations", id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error finding escalation %s: %v", id, err))
+			continue
+		}
+
+		record.Set("reported_at", now)
+		if err := app.Dao().SaveRecord(record); err != nil {
+			errs = append(errs, fmt.Errorf("error marking escalation %s as reported: %v", id, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func findOpenEscalations(app *pocketbase.PocketBase, filter string, params dbx.Params) ([]Escalation, error) {
+	params["status"] = EscalationStatusOpen
+
+	records, err := app.Dao().FindRecordsByFilter(
+		"escalations",
+		"status = {:status} && "+filter,
+		"-triggered_at",
+		0,
+		0,
+		params,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying escalations: %v", err)
+	}
+
+	if errs := app.Dao().ExpandRecords(records, []string{"policy", "behavior_notes"}, nil); len(errs) > 0 {
+		return nil, fmt.Errorf("error expanding escalations: %v", errs)
+	}
+
+	rules, err := LoadDetentionRules(app)
+	if err != nil {
+		return nil, err
+	}
+
+	escalations := []Escalation{}
+	for _, record := range records {
+		policy := EscalationPolicy{ID: record.GetString("policy")}
+		if policyRecord := record.ExpandedOne("policy"); policyRecord != nil {
+			policy.Name = policyRecord.GetString("name")
+			policy.Level = policyRecord.GetInt("level")
+			policy.WindowDays = policyRecord.GetInt("window_days")
+			policy.Action = policyRecord.GetString("action")
+		}
+
+		student := StudentDetentionSummary{
+			StudentID:       record.GetString("student_id"),
+			FirstName:       record.GetString("first_name"),
+			LastName:        record.GetString("last_name"),
+			Email:           record.GetString("email"),
+			Grade:           record.GetString("grade"),
+			HomeRoomAdvisor: record.GetString("homeroom_advisor"),
+			DetentionCount:  record.GetInt("detention_count"),
+			TotalSeverity:   record.GetFloat("total_severity"),
+		}
+		for _, noteRecord := range record.ExpandedAll("behavior_notes") {
+			note := detentionNoteFromRecord(noteRecord)
+			rules.Classify(&note)
+			student.DetentionNotes = append(student.DetentionNotes, note)
+		}
+
+		escalations = append(escalations, escalationFromPolicy(record, policy, student))
+	}
+
+	sort.SliceStable(escalations, func(i, j int) bool {
+		return escalations[i].Level > escalations[j].Level
+	})
+
+	return escalations, nil
+}
+
+// UpdateEscalationTimestamps stamps acknowledged_at and resolved_at when an
+// escalation moves through its lifecycle
+func UpdateEscalationTimestamps(record *models.Record, original *models.Record) {
+	status := record.GetString("status")
+	if original != nil && original.GetString("status") == status {
+		return
+	}
+
+	now := types.NowDateTime()
+
+	switch status {
+	case EscalationStatusAcknowledged:
+		if record.GetDateTime("acknowledged_at").IsZero() {
+			record.Set("acknowledged_at", now)
+		}
+	case EscalationStatusResolved:
+		if record.GetDateTime("acknowledged_at").IsZero() {
+			record.Set("acknowledged_at", now)
+		}
+		record.Set("resolved_at", now)
+	case EscalationStatusOpen:
+		record.Set("acknowledged_at", "")
+		record.Set("resolved_at", "")
+	}
+}
@@ -0,0 +1,140 @@
+package tasks
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// CalendarEvent is an all-day span read from an iCalendar (ICS) file. End is
+// the last day of the event, not the day after it.
+type CalendarEvent struct {
+	UID     string    `json:"uid"`
+	Summary string    `json:"summary"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+// ParseICS reads the VEVENTs of an iCalendar file. Only the properties needed
+// for the school calendar are read; recurring events are not expanded.
+func ParseICS(r io.Reader) ([]CalendarEvent, error) {
+	lines, err := unfoldICSLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []CalendarEvent
+	var event *CalendarEvent
+	var endIsExclusive bool
+	var hasEnd bool
+
+	for i, line := range lines {
+		name, params, value := splitICSLine(line)
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = &CalendarEvent{}
+			endIsExclusive, hasEnd = false, false
+		case name == "END" && value == "VEVENT":
+			if event == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN:VEVENT", i+1)
+			}
+			if event.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: event %q has no DTSTART", i+1, event.Summary)
+			}
+
+			switch {
+			case !hasEnd:
+				event.End = event.Start
+			case endIsExclusive && event.End.After(event.Start):
+				// All-day events end on the morning of the following day
+				event.End = event.End.AddDate(0, 0, -1)
+			}
+
+			events = append(events, *event)
+			event = nil
+		case event == nil:
+			continue
+		case name == "UID":
+			event.UID = value
+		case name == "SUMMARY":
+			event.Summary = unescapeICSText(value)
+		case name == "DTSTART":
+			event.Start, _, err = parseICSDate(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+		case name == "DTEND":
+			event.End, endIsExclusive, err = parseICSDate(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			hasEnd = true
+		}
+	}
+
+	return events, nil
+}
+
+// unfoldICSLines joins lines continued with a leading space or tab
+func unfoldICSLines(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading calendar: %v", err)
+	}
+
+	return lines, nil
+}
+
+// splitICSLine splits "NAME;PARAM=x:value" into its parts
+func splitICSLine(line string) (string, map[string]string, string) {
+	head, value, _ := strings.Cut(line, ":")
+
+	parts := strings.Split(head, ";")
+	params := map[string]string{}
+	for _, part := range parts[1:] {
+		key, val, _ := strings.Cut(part, "=")
+		params[strings.ToUpper(key)] = val
+	}
+
+	return strings.ToUpper(parts[0]), params, value
+}
+
+// parseICSDate returns the calendar day of a DATE or DATE-TIME value, and
+// whether it is a plain date
+func parseICSDate(params map[string]string, value string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		day, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid date %q", value)
+		}
+		return day, true, nil
+	}
+
+	day, err := time.Parse("20060102T150405", strings.TrimSuffix(value, "Z"))
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid date-time %q", value)
+	}
+
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC), false, nil
+}
+
+func unescapeICSText(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
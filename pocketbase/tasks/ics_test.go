@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseICS(t *testing.T) {
+	file, err := os.Open("testdata/school-calendar.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	events, err := ParseICS(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	want := []CalendarEvent{
+		// DTEND of an all-day event is the day after it ends
+		{UID: "autumn-term@school", Summary: "Autumn Term", Start: day(2026, 9, 1), End: day(2026, 12, 18)},
+		{UID: "half-term@school", Summary: "Half Term", Start: day(2026, 10, 26), End: day(2026, 10, 30)},
+		// Without DTEND the event lasts a single day
+		{UID: "inset@school", Summary: "INSET Day", Start: day(2026, 11, 2), End: day(2026, 11, 2)},
+		// DATE-TIME values are cut to their day and their DTEND is inclusive
+		{UID: "review@school", Summary: "Mid-term review, Year 10", Start: day(2026, 11, 5), End: day(2026, 11, 5)},
+		// Folded lines continue after the leading space or tab
+		{UID: "folded@school", Summary: "Winter holiday for students and staff", Start: day(2026, 12, 21), End: day(2027, 1, 4)},
+	}
+
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, event := range events {
+		if event.UID != want[i].UID || event.Summary != want[i].Summary || !event.Start.Equal(want[i].Start) || !event.End.Equal(want[i].End) {
+			t.Errorf("event %d:\n got %+v\nwant %+v", i, event, want[i])
+		}
+	}
+}
+
+func TestParseICSErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ics  string
+	}{
+		{"no DTSTART", "BEGIN:VEVENT\nSUMMARY:Term\nEND:VEVENT\n"},
+		{"END without BEGIN", "END:VEVENT\n"},
+		{"invalid date", "BEGIN:VEVENT\nDTSTART;VALUE=DATE:2026-09-01\nEND:VEVENT\n"},
+		{"invalid date-time", "BEGIN:VEVENT\nDTSTART:20260901T9AM\nEND:VEVENT\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseICS(strings.NewReader(tt.ics)); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
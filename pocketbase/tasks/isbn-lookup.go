@@ -0,0 +1,375 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path/filepath"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/forms"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/veritymedia/massolit/pocketbase/isbn"
+)
+
+// ISBNOverrideSource is the source of books found in isbn_overrides
+const ISBNOverrideSource = "override"
+
+// isbnNotFoundTTL is how long an ISBN no provider knows is remembered before
+// the providers are asked again
+const isbnNotFoundTTL = 24 * time.Hour
+
+// ISBNLookup is a cached ISBN lookup as returned by the API
+type ISBNLookup struct {
+	ID             string         `json:"id"`
+	ISBN13         string         `json:"isbn13"`
+	ISBN10         string         `json:"isbn10"`
+	Title          string         `json:"title"`
+	Subtitle       string         `json:"subtitle"`
+	Authors        []string       `json:"authors"`
+	Publisher      string         `json:"publisher"`
+	PublishedDate  string         `json:"published_date"`
+	PageCount      int            `json:"page_count"`
+	Source         string         `json:"source"`
+	Cover          string         `json:"cover"`
+	CoverSourceURL string         `json:"cover_source_url"`
+	FetchedAt      types.DateTime `json:"fetched_at"`
+}
+
+// ISBNResolver looks ISBNs up through a chain of providers, caching the
+// results and their covers in the isbn_cache collection
+type ISBNResolver struct {
+	app   *pocketbase.PocketBase
+	chain isbn.Chain
+}
+
+// NewISBNResolver creates a resolver asking isbn_overrides first, then the
+// given online providers in order
+func NewISBNResolver(app *pocketbase.PocketBase, providers ...isbn.Provider) *ISBNResolver {
+	chain := isbn.Chain{&isbnOverrideProvider{app: app}}
+	chain = append(chain, providers...)
+
+	return &ISBNResolver{app: app, chain: chain}
+}
+
+// Lookup returns the book for an ISBN-10 or ISBN-13. Cached results are
+// returned without asking the providers unless refresh is set. It returns
+// isbn.ErrInvalid for a bad ISBN and isbn.ErrNotFound if no provider knows
+// the book. If the providers fail, a stale cached result is returned if there
+// is one.
+func (r *ISBNResolver) Lookup(ctx context.Context, value string, refresh bool) (*ISBNLookup, error) {
+	isbn13, err := isbn.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	cached, err := r.app.Dao().FindFirstRecordByFilter("isbn_cache", "isbn13 = {:isbn}", dbx.Params{"isbn": isbn13})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error finding cached ISBN %s: %v", isbn13, err)
+	}
+
+	if cached != nil && !refresh {
+		if cached.GetBool("found") {
+			return isbnLookupFromRecord(cached), nil
+		}
+		if time.Since(cached.GetDateTime("fetched_at").Time()) < isbnNotFoundTTL {
+			return nil, isbn.ErrNotFound
+		}
+	}
+
+	book, err := r.chain.Lookup(ctx, isbn13)
+	if err != nil && cached != nil && cached.GetBool("found") {
+		log.Printf("Error looking up ISBN %s, using cached result: %v", isbn13, err)
+		return isbnLookupFromRecord(cached), nil
+	}
+	if errors.Is(err, isbn.ErrNotFound) {
+		if err := r.saveNotFound(cached, isbn13); err != nil {
+			log.Printf("Error caching unknown ISBN %s: %v", isbn13, err)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error looking up ISBN %s: %w", isbn13, err)
+	}
+
+	record, err := r.saveBook(ctx, cached, book)
+	if err != nil {
+		return nil, err
+	}
+
+	return isbnLookupFromRecord(record), nil
+}
+
+func (r *ISBNResolver) newCacheRecord(isbn13 string) (*models.Record, error) {
+	collection, err := r.app.Dao().FindCollectionByNameOrId("isbn_cache")
+	if err != nil {
+		return nil, fmt.Errorf("error finding isbn_cache collection: %v", err)
+	}
+
+	record := models.NewRecord(collection)
+	record.Set("isbn13", isbn13)
+
+	return record, nil
+}
+
+func (r *ISBNResolver) saveNotFound(record *models.Record, isbn13 string) error {
+	if record == nil {
+		var err error
+		if record, err = r.newCacheRecord(isbn13); err != nil {
+			return err
+		}
+	}
+
+	record.Set("found", false)
+	record.Set("fetched_at", types.NowDateTime())
+
+	return r.app.Dao().SaveRecord(record)
+}
+
+// saveBook caches a found book, downloading its cover. A cover that cannot be
+// downloaded is logged and left out.
+func (r *ISBNResolver) saveBook(ctx context.Context, record *models.Record, book *isbn.Book) (*models.Record, error) {
+	if record == nil {
+		var err error
+		if record, err = r.newCacheRecord(book.ISBN13); err != nil {
+			return nil, err
+		}
+	}
+
+	form := forms.NewRecordUpsert(r.app, record)
+	err := form.LoadData(map[string]any{
+		"isbn13":           book.ISBN13,
+		"isbn10":           book.ISBN10,
+		"found":            true,
+		"title":            book.Title,
+		"subtitle":         book.Subtitle,
+		"authors":          book.Authors,
+		"publisher":        book.Publisher,
+		"published_date":   book.PublishedDate,
+		"page_count":       book.PageCount,
+		"source":           book.Source,
+		"cover_source_url": book.CoverURL,
+		"fetched_at":       types.NowDateTime(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading ISBN %s: %v", book.ISBN13, err)
+	}
+
+	cover, err := r.loadCover(ctx, book)
+	if err != nil {
+		log.Printf("Error fetching cover of ISBN %s: %v", book.ISBN13, err)
+	}
+	if cover != nil {
+		if err := form.AddFiles("cover", cover); err != nil {
+			log.Printf("Error adding cover of ISBN %s: %v", book.ISBN13, err)
+		}
+	}
+
+	if err := form.Submit(); err != nil {
+		return nil, fmt.Errorf("error caching ISBN %s: %v", book.ISBN13, err)
+	}
+
+	return record, nil
+}
+
+// loadCover returns the cover of a book as a file to store. A cover uploaded
+// to isbn_overrides is used as is, otherwise it is downloaded from the
+// provider.
+func (r *ISBNResolver) loadCover(ctx context.Context, book *isbn.Book) (*filesystem.File, error) {
+	if book.Source == ISBNOverrideSource {
+		override, err := r.app.Dao().FindFirstRecordByFilter("isbn_overrides", "isbn13 = {:isbn}", dbx.Params{"isbn": book.ISBN13})
+		if err == nil && override.GetString("cover") != "" {
+			return copyRecordFile(r.app, override, "cover", "cover_"+book.ISBN13)
+		}
+	}
+
+	if book.CoverURL == "" {
+		return nil, nil
+	}
+
+	data, contentType, err := isbn.FetchCover(ctx, book.CoverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return filesystem.NewFileFromBytes(data, "cover_"+book.ISBN13+coverExtension(contentType))
+}
+
+// coverExtension returns the file extension of a cover image content type
+func coverExtension(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+
+	return ".jpg"
+}
+
+// copyRecordFile reads a stored file of record so it can be added to another
+// record as name, keeping the original extension
+func copyRecordFile(app *pocketbase.PocketBase, record *models.Record, field string, name string) (*filesystem.File, error) {
+	stored := record.GetString(field)
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return nil, fmt.Errorf("error opening file storage: %v", err)
+	}
+	defer fsys.Close()
+
+	reader, err := fsys.GetFile(record.BaseFilesPath() + "/" + stored)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", stored, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", stored, err)
+	}
+
+	return filesystem.NewFileFromBytes(data, name+filepath.Ext(stored))
+}
+
+func isbnLookupFromRecord(record *models.Record) *ISBNLookup {
+	lookup := &ISBNLookup{
+		ID:             record.Id,
+		ISBN13:         record.GetString("isbn13"),
+		ISBN10:         record.GetString("isbn10"),
+		Title:          record.GetString("title"),
+		Subtitle:       record.GetString("subtitle"),
+		Authors:        []string{},
+		Publisher:      record.GetString("publisher"),
+		PublishedDate:  record.GetString("published_date"),
+		PageCount:      record.GetInt("page_count"),
+		Source:         record.GetString("source"),
+		CoverSourceURL: record.GetString("cover_source_url"),
+		FetchedAt:      record.GetDateTime("fetched_at"),
+	}
+
+	_ = record.UnmarshalJSONField("authors", &lookup.Authors)
+
+	if cover := record.GetString("cover"); cover != "" {
+		lookup.Cover = "/api/files/" + record.BaseFilesPath() + "/" + cover
+	}
+
+	return lookup
+}
+
+// AttachBookCover stores the cached cover of a book's ISBN on the book, if it
+// does not have one yet. The ISBN is looked up if it is not cached.
+func (r *ISBNResolver) AttachBookCover(ctx context.Context, book *models.Record) error {
+	if book.GetString("cover") != "" {
+		return nil
+	}
+
+	value := book.GetString("isbn")
+	if value == "" || value == "0" {
+		return nil
+	}
+
+	lookup, err := r.Lookup(ctx, value, false)
+	if errors.Is(err, isbn.ErrInvalid) || errors.Is(err, isbn.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cached, err := r.app.Dao().FindRecordById("isbn_cache", lookup.ID)
+	if err != nil {
+		return fmt.Errorf("error finding cached ISBN %s: %v", lookup.ISBN13, err)
+	}
+	if cached.GetString("cover") == "" {
+		return nil
+	}
+
+	cover, err := copyRecordFile(r.app, cached, "cover", "cover_"+lookup.ISBN13)
+	if err != nil {
+		return err
+	}
+
+	form := forms.NewRecordUpsert(r.app, book)
+	if err := form.AddFiles("cover", cover); err != nil {
+		return err
+	}
+
+	if err := form.Submit(); err != nil {
+		return fmt.Errorf("error saving cover of book %s: %v", book.Id, err)
+	}
+
+	return nil
+}
+
+// NormalizeISBNOverride validates the ISBN of an isbn_overrides record and
+// stores it as an ISBN-13, so overrides can be entered either way
+func NormalizeISBNOverride(record *models.Record) error {
+	isbn13, err := isbn.Parse(record.GetString("isbn13"))
+	if err != nil {
+		return err
+	}
+
+	record.Set("isbn13", isbn13)
+
+	return nil
+}
+
+// NormalizeBookISBN stores value as the ISBN-13 of a books record when it is a
+// valid ISBN-10 or ISBN-13, so scanned and typed ISBNs match. Anything else is
+// stored as it is.
+func NormalizeBookISBN(record *models.Record, value string) {
+	isbn13, err := isbn.Parse(value)
+	if err != nil {
+		return
+	}
+
+	record.Set("isbn", isbn13)
+}
+
+// isbnOverrideProvider finds books in the isbn_overrides collection, for
+// books the online providers get wrong or do not know
+type isbnOverrideProvider struct {
+	app *pocketbase.PocketBase
+}
+
+func (p *isbnOverrideProvider) Name() string {
+	return ISBNOverrideSource
+}
+
+func (p *isbnOverrideProvider) Lookup(ctx context.Context, isbn13 string) (*isbn.Book, error) {
+	record, err := p.app.Dao().FindFirstRecordByFilter("isbn_overrides", "isbn13 = {:isbn}", dbx.Params{"isbn": isbn13})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, isbn.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	book := &isbn.Book{
+		Title:         record.GetString("title"),
+		Subtitle:      record.GetString("subtitle"),
+		Authors:       splitList(record.GetString("authors")),
+		Publisher:     record.GetString("publisher"),
+		PublishedDate: record.GetString("published_date"),
+	}
+
+	// An uploaded cover stops the chain asking online providers for one
+	if cover := record.GetString("cover"); cover != "" {
+		book.CoverURL = appURL(p.app) + "/api/files/" + record.BaseFilesPath() + "/" + cover
+	}
+
+	return book, nil
+}
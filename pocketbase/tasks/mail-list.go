@@ -0,0 +1,157 @@
+package tasks
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// ReportScope limits a report to the students a recipient is responsible for.
+// An empty field does not restrict the report.
+type ReportScope struct {
+	Grades          []string `json:"grades"`
+	HomeRoomAdvisor string   `json:"homeroom_advisor"`
+	Categories      []string `json:"categories"`
+}
+
+// Recipient is a mail_list entry subscribed to a report
+type Recipient struct {
+	Email string      `json:"email"`
+	Scope ReportScope `json:"scope"`
+}
+
+// GetReportRecipients returns the mail_list entries subscribed to sub
+func GetReportRecipients(app *pocketbase.PocketBase, sub string) ([]Recipient, error) {
+	records, err := app.Dao().FindRecordsByFilter("mail_list", "subs ~ {:sub}", "", 100, 0, dbx.Params{"sub": sub})
+	if err != nil {
+		return nil, fmt.Errorf("could not find mail_list records: %v", err)
+	}
+
+	recipients := []Recipient{}
+	for _, record := range records {
+		recipients = append(recipients, recipientFromRecord(record))
+	}
+
+	return recipients, nil
+}
+
+func recipientFromRecord(record *models.Record) Recipient {
+	scope := ParseReportScope(record.GetString("grades"), record.GetString("homeroom_advisor"), "")
+	scope.Categories = record.GetStringSlice("categories")
+
+	return Recipient{
+		Email: record.GetString("email"),
+		Scope: scope,
+	}
+}
+
+// ParseReportScope builds a scope from comma separated lists of grades and
+// categories, eg. "Grade 9, Grade 10"
+func ParseReportScope(grades string, advisor string, categories string) ReportScope {
+	return ReportScope{
+		Grades:          splitList(grades),
+		HomeRoomAdvisor: strings.TrimSpace(advisor),
+		Categories:      splitList(categories),
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// IsWholeSchool reports whether the scope does not restrict the report at all
+func (scope ReportScope) IsWholeSchool() bool {
+	return len(scope.Grades) == 0 && scope.HomeRoomAdvisor == "" && len(scope.Categories) == 0
+}
+
+// includesStudent checks the grade and homeroom advisor filters
+func (scope ReportScope) includesStudent(grade string, advisor string) bool {
+	if len(scope.Grades) > 0 && !containsFold(scope.Grades, grade) {
+		return false
+	}
+
+	if scope.HomeRoomAdvisor != "" && !strings.EqualFold(scope.HomeRoomAdvisor, strings.TrimSpace(advisor)) {
+		return false
+	}
+
+	return true
+}
+
+// includesNote checks every filter against a single detention
+func (scope ReportScope) includesNote(note DetentionNote) bool {
+	if !scope.includesStudent(note.Grade, note.HomeRoomAdvisor) {
+		return false
+	}
+
+	return len(scope.Categories) == 0 || containsFold(scope.Categories, note.Category)
+}
+
+// includesEscalation keeps escalations for the recipient's students that
+// involve at least one detention in the recipient's categories
+func (scope ReportScope) includesEscalation(escalation Escalation) bool {
+	if !scope.includesStudent(escalation.Grade, escalation.HomeRoomAdvisor) {
+		return false
+	}
+
+	if len(scope.Categories) == 0 {
+		return true
+	}
+
+	for _, note := range escalation.DetentionNotes {
+		if containsFold(scope.Categories, note.Category) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ForScope returns a copy of the report containing only what scope includes
+func (r DetentionReport) ForScope(scope ReportScope) DetentionReport {
+	if scope.IsWholeSchool() {
+		return r
+	}
+
+	filtered := DetentionReport{Mode: r.Mode, Date: r.Date}
+
+	for _, note := range r.Detentions {
+		if scope.includesNote(note) {
+			filtered.Detentions = append(filtered.Detentions, note)
+		}
+	}
+
+	for _, note := range r.Overdue {
+		if scope.includesNote(note) {
+			filtered.Overdue = append(filtered.Overdue, note)
+		}
+	}
+
+	for _, escalation := range r.Escalations {
+		if scope.includesEscalation(escalation) {
+			filtered.Escalations = append(filtered.Escalations, escalation)
+		}
+	}
+
+	return filtered
+}
+
+func containsFold(values []string, value string) bool {
+	value = strings.TrimSpace(value)
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,35 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/veritymedia/massolit/pocketbase/managebac"
+)
+
+// ManageBacStatusConfigName is the config row holding the ManageBac circuit
+// breaker state, so admins can see outages from the dashboard
+const ManageBacStatusConfigName = "managebac_status"
+
+// RecordManageBacStatus persists a circuit breaker state change to the config
+// collection
+func RecordManageBacStatus(app *pocketbase.PocketBase, status managebac.BreakerStatus) {
+	switch status.State {
+	case managebac.BreakerOpen:
+		fmt.Printf("MANAGEBAC::STATUS Circuit breaker opened after %d failures: %s\n", status.ConsecutiveFailures, status.LastError)
+	default:
+		fmt.Printf("MANAGEBAC::STATUS Circuit breaker is now %s\n", status.State)
+	}
+
+	value, err := json.Marshal(status)
+	if err != nil {
+		log.Printf("Error encoding ManageBac status: %v", err)
+		return
+	}
+
+	if err := SetConfigValue(app, ManageBacStatusConfigName, string(value)); err != nil {
+		log.Printf("Error saving ManageBac status: %v", err)
+	}
+}
@@ -0,0 +1,400 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/veritymedia/massolit/pocketbase/managebac"
+)
+
+const (
+	// OverdueReminderScheduleConfigName is the config row holding the cron
+	// expression of the overdue book reminders
+	OverdueReminderScheduleConfigName = "overdue_reminder_schedule"
+
+	// DefaultOverdueReminderSchedule sends reminders at 08:00 every weekday
+	DefaultOverdueReminderSchedule = "0 8 * * 1-5"
+
+	// LibrarySubscription is the mail_list subscription for the overdue books
+	// list
+	LibrarySubscription = "library"
+)
+
+const (
+	// overdueReminderMaxReminders is how many reminders a student gets about
+	// a rental before the library has to follow it up in person
+	overdueReminderMaxReminders = 3
+
+	// overdueReminderInterval is the least time between two reminders about
+	// the same rental
+	overdueReminderInterval = 7 * 24 * time.Hour
+)
+
+// OverdueRental is an open rental that is past its due date
+type OverdueRental struct {
+	RentalID       string
+	StudentID      string
+	StudentName    string
+	BookCode       string
+	Title          string
+	DueAt          time.Time
+	DaysOverdue    int
+	RemindersSent  int
+	LastRemindedAt time.Time
+}
+
+// reminderDue reports whether the student should be reminded about the
+// rental again
+func (r OverdueRental) reminderDue(now time.Time) bool {
+	if r.RemindersSent >= overdueReminderMaxReminders {
+		return false
+	}
+
+	return r.LastRemindedAt.IsZero() || now.Sub(r.LastRemindedAt) >= overdueReminderInterval
+}
+
+// GetOverdueRentals returns the open rentals that were due back before now,
+// most overdue first. Rentals without a due date are never overdue.
+func GetOverdueRentals(app *pocketbase.PocketBase, now time.Time) ([]OverdueRental, error) {
+	nowDate, err := types.ParseDateTime(now)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := app.Dao().FindRecordsByFilter(
+		"rentals",
+		"returned_at = '' && due_at != '' && due_at < {:now}",
+		"due_at",
+		0,
+		0,
+		dbx.Params{"now": nowDate.String()},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying overdue rentals: %v", err)
+	}
+
+	if errs := app.Dao().ExpandRecords(records, []string{"book_instance.book"}, nil); len(errs) > 0 {
+		return nil, fmt.Errorf("error expanding rentals: %v", errs)
+	}
+
+	rentals := make([]OverdueRental, 0, len(records))
+	for _, record := range records {
+		rentals = append(rentals, overdueRentalFromRecord(record, now))
+	}
+
+	return rentals, nil
+}
+
+func overdueRentalFromRecord(record *models.Record, now time.Time) OverdueRental {
+	rental := OverdueRental{
+		RentalID:       record.Id,
+		StudentID:      record.GetString("rented_to"),
+		DueAt:          record.GetDateTime("due_at").Time(),
+		RemindersSent:  record.GetInt("reminders_sent"),
+		LastRemindedAt: record.GetDateTime("last_reminded_at").Time(),
+	}
+	rental.DaysOverdue = int(now.Sub(rental.DueAt).Hours() / 24)
+
+	if instance := record.ExpandedOne("book_instance"); instance != nil {
+		rental.BookCode = instance.GetString("book_code")
+
+		if book := instance.ExpandedOne("book"); book != nil {
+			rental.Title = book.GetString("title")
+		}
+	}
+
+	return rental
+}
+
+// HandleOverdueReminders emails students about their overdue books and sends
+// the library subscribers the full overdue list. It only runs on teaching
+// days and once per day. Students are reminded at most
+// overdueReminderMaxReminders times per rental, a week apart.
+func HandleOverdueReminders(ctx context.Context, app *pocketbase.PocketBase, client *managebac.Client, trigger string) error {
+	now := time.Now()
+	period := reportPeriod(now)
+
+	if teaching, err := IsTeachingDay(app, now); err != nil {
+		log.Printf("Error checking school calendar, sending overdue reminders anyway: %v", err)
+	} else if !teaching {
+		fmt.Printf("CRON::OVERDUE_REMINDERS %s is not a teaching day, skipping\n", period)
+		return nil
+	}
+
+	run, err := claimReportRun(app, EmailTypeOverdueReminder, period, trigger)
+	if errors.Is(err, ErrReportAlreadyRun) {
+		fmt.Printf("CRON::OVERDUE_REMINDERS Reminders for %s have already been sent, skipping\n", period)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	rentals, err := GetOverdueRentals(app, now)
+	if err != nil {
+		finishReportRun(app, run, ReportRunFailed, err)
+		return err
+	}
+
+	if len(rentals) == 0 {
+		fmt.Println("CRON::OVERDUE_REMINDERS No overdue books")
+		finishReportRun(app, run, ReportRunEmpty, nil)
+		return nil
+	}
+
+	students := lookupRentalStudents(ctx, client, rentals)
+	for i := range rentals {
+		if student := students[rentals[i].StudentID]; student != nil {
+			rentals[i].StudentName = studentName(student)
+		}
+	}
+
+	errs := []error{
+		SendOverdueReminders(app, students, rentals, now),
+		SendOverdueReport(app, rentals, now),
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("Error sending overdue reminders: %v", err)
+		finishReportRun(app, run, ReportRunFailed, err)
+		return err
+	}
+
+	finishReportRun(app, run, ReportRunSent, nil)
+
+	return nil
+}
+
+// lookupRentalStudents fetches the ManageBac students with overdue rentals.
+// Students that cannot be fetched are left out and logged.
+func lookupRentalStudents(ctx context.Context, client *managebac.Client, rentals []OverdueRental) map[string]*managebac.Student {
+	students := map[string]*managebac.Student{}
+	if client == nil {
+		return students
+	}
+
+	for _, rental := range rentals {
+		if _, ok := students[rental.StudentID]; ok {
+			continue
+		}
+
+		student, err := client.GetStudent(ctx, rental.StudentID)
+		if errors.Is(err, managebac.ErrCircuitOpen) {
+			log.Printf("Error fetching students with overdue books: %v", err)
+			return students
+		}
+		if err != nil {
+			log.Printf("Error fetching student %s: %v", rental.StudentID, err)
+		}
+		students[rental.StudentID] = student
+	}
+
+	return students
+}
+
+func studentName(student *managebac.Student) string {
+	return strings.TrimSpace(student.FirstName + " " + student.LastName)
+}
+
+// SendOverdueReminders emails each student one reminder listing their overdue
+// books that are due a reminder, and counts it on the rentals. Students
+// without an email address in ManageBac are skipped.
+func SendOverdueReminders(app *pocketbase.PocketBase, students map[string]*managebac.Student, rentals []OverdueRental, now time.Time) error {
+	byStudent := map[string][]*OverdueRental{}
+	for i := range rentals {
+		if rentals[i].reminderDue(now) {
+			byStudent[rentals[i].StudentID] = append(byStudent[rentals[i].StudentID], &rentals[i])
+		}
+	}
+
+	var errs []error
+	sent := 0
+
+	for studentID, studentRentals := range byStudent {
+		student := students[studentID]
+		if student == nil || student.Archived || student.Email == "" {
+			fmt.Printf("CRON::OVERDUE_REMINDERS No email address for student %s, skipping\n", studentID)
+			continue
+		}
+
+		if err := sendOverdueReminder(app, student, studentRentals); err != nil {
+			errs = append(errs, fmt.Errorf("error sending overdue reminder to %s: %v", student.Email, err))
+			continue
+		}
+		sent++
+
+		for _, rental := range studentRentals {
+			markRentalReminded(app, rental)
+		}
+	}
+
+	if sent > 0 {
+		fmt.Printf("CRON::OVERDUE_REMINDERS Sent %d overdue reminders to students\n", sent)
+	}
+
+	return errors.Join(errs...)
+}
+
+// markRentalReminded counts a reminder on the rental. Failing to record it is
+// logged, as the email itself has already been sent.
+func markRentalReminded(app *pocketbase.PocketBase, rental *OverdueRental) {
+	rental.RemindersSent++
+	rental.LastRemindedAt = time.Now()
+
+	record, err := app.Dao().FindRecordById("rentals", rental.RentalID)
+	if err != nil {
+		log.Printf("Error finding rental %s: %v", rental.RentalID, err)
+		return
+	}
+
+	record.Set("reminders_sent", rental.RemindersSent)
+	record.Set("last_reminded_at", types.NowDateTime())
+
+	if err := app.Dao().SaveRecord(record); err != nil {
+		log.Printf("Error saving reminder on rental %s: %v", rental.RentalID, err)
+	}
+}
+
+// SendOverdueReport emails the full overdue list to the library mail_list
+// subscribers. A retried run skips anyone who already got today's list.
+func SendOverdueReport(app *pocketbase.PocketBase, rentals []OverdueRental, now time.Time) error {
+	recipients, err := GetReportRecipients(app, LibrarySubscription)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, recipient := range recipients {
+		if sent, err := hasReceivedEmail(app, recipient.Email, EmailTypeOverdueReport, now); err != nil {
+			log.Printf("Error checking email log for %s: %v", recipient.Email, err)
+		} else if sent {
+			continue
+		}
+
+		if err := sendOverdueReport(app, recipient.Email, rentals, now); err != nil {
+			errs = append(errs, fmt.Errorf("error sending overdue list to %s: %v", recipient.Email, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// overdueRow is a rental as shown in the overdue emails
+type overdueRow struct {
+	StudentID     string
+	StudentName   string
+	Title         string
+	BookCode      string
+	DueDate       string
+	DaysOverdue   int
+	RemindersSent int
+}
+
+func newOverdueRow(rental OverdueRental) overdueRow {
+	return overdueRow{
+		StudentID:     rental.StudentID,
+		StudentName:   rental.StudentName,
+		Title:         rental.Title,
+		BookCode:      rental.BookCode,
+		DueDate:       rental.DueAt.Format("Monday 2 January 2006"),
+		DaysOverdue:   rental.DaysOverdue,
+		RemindersSent: rental.RemindersSent,
+	}
+}
+
+// overdueReminderEmail is the data passed to the overdue reminder templates
+type overdueReminderEmail struct {
+	SchoolName    string
+	StudentName   string
+	Books         []overdueRow
+	FinalReminder bool
+}
+
+func sendOverdueReminder(app *pocketbase.PocketBase, student *managebac.Student, rentals []*OverdueRental) error {
+	sort.Slice(rentals, func(i, j int) bool {
+		return rentals[i].DueAt.Before(rentals[j].DueAt)
+	})
+
+	data := overdueReminderEmail{
+		SchoolName:    app.Settings().Meta.AppName,
+		StudentName:   studentName(student),
+		FinalReminder: true,
+	}
+	for _, rental := range rentals {
+		data.Books = append(data.Books, newOverdueRow(*rental))
+		if rental.RemindersSent+1 < overdueReminderMaxReminders {
+			data.FinalReminder = false
+		}
+	}
+
+	htmlBody, textBody, err := renderEmail(app, OverdueReminderTemplate, data)
+	if err != nil {
+		return err
+	}
+
+	subject := "Overdue library book"
+	if len(rentals) > 1 {
+		subject = fmt.Sprintf("%d overdue library books", len(rentals))
+	}
+
+	message := &mailer.Message{
+		From: mail.Address{
+			Address: app.Settings().Meta.SenderAddress,
+			Name:    app.Settings().Meta.SenderName,
+		},
+		To:      []mail.Address{{Address: student.Email}},
+		Subject: subject,
+		HTML:    htmlBody,
+		Text:    textBody,
+	}
+
+	return sendEmail(app, EmailTypeOverdueReminder, message)
+}
+
+// overdueReportEmail is the data passed to the library overdue list templates
+type overdueReportEmail struct {
+	Date         string
+	AppURL       string
+	MaxReminders int
+	Books        []overdueRow
+}
+
+func sendOverdueReport(app *pocketbase.PocketBase, email string, rentals []OverdueRental, now time.Time) error {
+	data := overdueReportEmail{
+		Date:         now.Format("Monday 2 January"),
+		AppURL:       appURL(app),
+		MaxReminders: overdueReminderMaxReminders,
+	}
+	for _, rental := range rentals {
+		data.Books = append(data.Books, newOverdueRow(rental))
+	}
+
+	htmlBody, textBody, err := renderEmail(app, OverdueReportTemplate, data)
+	if err != nil {
+		return err
+	}
+
+	message := &mailer.Message{
+		From: mail.Address{
+			Address: app.Settings().Meta.SenderAddress,
+			Name:    app.Settings().Meta.SenderName,
+		},
+		To:      []mail.Address{{Address: email}},
+		Subject: fmt.Sprintf("Overdue Library Books - %s", now.Format("2006-01-02")),
+		HTML:    htmlBody,
+		Text:    textBody,
+	}
+
+	return sendEmail(app, EmailTypeOverdueReport, message)
+}
@@ -0,0 +1,260 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/veritymedia/massolit/pocketbase/managebac"
+)
+
+const (
+	ParentNotificationSent      = "sent"
+	ParentNotificationFailed    = "failed"
+	ParentNotificationNoContact = "no_contact"
+)
+
+// parentNotificationMaxAttempts is how many times a failed parent email is
+// tried before giving up
+const parentNotificationMaxAttempts = 3
+
+// parentDetentionEmail is the data passed to the parent detention templates
+type parentDetentionEmail struct {
+	SchoolName  string
+	ParentName  string
+	StudentName string
+	Detention   string
+	Date        string
+	Reason      string
+	Notes       string
+	ReportedBy  string
+}
+
+// NotifyParents emails the parents of students with upcoming detentions that
+// are visible to parents in ManageBac. Parent contact details come from
+// ManageBac. Each parent is emailed once per note, which is recorded in
+// parent_notifications; failed emails are retried on later runs.
+func NotifyParents(ctx context.Context, app *pocketbase.PocketBase, client *managebac.Client) error {
+	rules, err := LoadDetentionRules(app)
+	if err != nil {
+		return err
+	}
+
+	today, _ := dayRange(time.Now().UTC())
+
+	notes, err := findDetentionNotes(
+		app,
+		rules,
+		false,
+		"visible_to_parents = true && action_complete = false && deleted_at = '' && next_step_date >= {:today}",
+		dbx.Params{"today": today.String()},
+		"next_step_date",
+		0,
+	)
+	if err != nil {
+		return fmt.Errorf("error querying detention notes: %v", err)
+	}
+
+	studentParents := map[string][]managebac.Parent{}
+
+	var errs []error
+	sent := 0
+
+	for _, note := range notes {
+		notifications, err := findParentNotifications(app, note.RecordID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if len(notifications) > 0 && !hasRetryableNotification(notifications) {
+			continue
+		}
+
+		parents, ok := studentParents[note.StudentID]
+		if !ok {
+			parents, err = getStudentParents(ctx, client, note.StudentID)
+			if errors.Is(err, managebac.ErrCircuitOpen) {
+				return err
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error fetching parents of student %s: %v", note.StudentID, err))
+				continue
+			}
+			studentParents[note.StudentID] = parents
+		}
+
+		if len(parents) == 0 {
+			if len(notifications) == 0 {
+				saveParentNotification(app, nil, note, managebac.Parent{}, ParentNotificationNoContact, nil)
+			}
+			continue
+		}
+
+		for _, parent := range parents {
+			existing := notifications[strings.ToLower(parent.Email)]
+			if existing != nil && !isRetryableNotification(existing) {
+				continue
+			}
+
+			sendErr := sendParentDetentionEmail(app, note, parent)
+			if sendErr != nil {
+				errs = append(errs, fmt.Errorf("error emailing parent %s about note %s: %v", parent.Email, note.RecordID, sendErr))
+				saveParentNotification(app, existing, note, parent, ParentNotificationFailed, sendErr)
+				continue
+			}
+
+			saveParentNotification(app, existing, note, parent, ParentNotificationSent, nil)
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		fmt.Printf("CRON::PARENT_NOTIFICATIONS Sent %d detention emails to parents\n", sent)
+	}
+
+	return errors.Join(errs...)
+}
+
+// getStudentParents returns the parents of a student who can be emailed
+func getStudentParents(ctx context.Context, client *managebac.Client, studentID string) ([]managebac.Parent, error) {
+	student, err := client.GetStudent(ctx, studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var parents []managebac.Parent
+	for _, parentID := range student.ParentIDs {
+		parent, err := client.GetParent(ctx, parentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if parent.Archived || parent.Email == "" {
+			continue
+		}
+		parents = append(parents, *parent)
+	}
+
+	return parents, nil
+}
+
+// findParentNotifications returns the parent_notifications of a note by
+// lowercase parent email
+func findParentNotifications(app *pocketbase.PocketBase, noteID string) (map[string]*models.Record, error) {
+	records, err := app.Dao().FindRecordsByFilter(
+		"parent_notifications",
+		"behavior_note = {:note}",
+		"",
+		0,
+		0,
+		dbx.Params{"note": noteID},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding parent notifications of note %s: %v", noteID, err)
+	}
+
+	notifications := map[string]*models.Record{}
+	for _, record := range records {
+		notifications[strings.ToLower(record.GetString("parent_email"))] = record
+	}
+
+	return notifications, nil
+}
+
+func hasRetryableNotification(notifications map[string]*models.Record) bool {
+	for _, record := range notifications {
+		if isRetryableNotification(record) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isRetryableNotification(record *models.Record) bool {
+	return record.GetString("status") == ParentNotificationFailed && record.GetInt("attempts") < parentNotificationMaxAttempts
+}
+
+// saveParentNotification records the outcome of emailing a parent. Failing to
+// record it is logged, as the email itself has already been handled.
+func saveParentNotification(app *pocketbase.PocketBase, record *models.Record, note DetentionNote, parent managebac.Parent, status string, sendErr error) {
+	if record == nil {
+		collection, err := app.Dao().FindCollectionByNameOrId("parent_notifications")
+		if err != nil {
+			log.Printf("Error finding parent_notifications collection: %v", err)
+			return
+		}
+
+		record = models.NewRecord(collection)
+		record.Set("behavior_note", note.RecordID)
+		record.Set("parent_email", parent.Email)
+		if parent.ID != 0 {
+			record.Set("parent_id", strconv.Itoa(parent.ID))
+		}
+	}
+
+	record.Set("status", status)
+	record.Set("error", "")
+	if sendErr != nil {
+		record.Set("error", sendErr.Error())
+	}
+
+	if status != ParentNotificationNoContact {
+		record.Set("attempts", record.GetInt("attempts")+1)
+	}
+	if status == ParentNotificationSent {
+		record.Set("sent_at", types.NowDateTime())
+	}
+
+	if err := app.Dao().SaveRecord(record); err != nil {
+		log.Printf("Error saving parent notification for note %s: %v", note.RecordID, err)
+	}
+}
+
+// sendParentDetentionEmail emails a single parent about their child's detention
+func sendParentDetentionEmail(app *pocketbase.PocketBase, note DetentionNote, parent managebac.Parent) error {
+	date := note.NextStepDate
+	if parsed, err := time.Parse(time.RFC3339, note.NextStepDate); err == nil {
+		date = parsed.Format("Monday 2 January 2006")
+	}
+
+	studentName := strings.TrimSpace(note.FirstName + " " + note.LastName)
+
+	htmlBody, textBody, err := renderEmail(app, ParentDetentionTemplate, parentDetentionEmail{
+		SchoolName:  app.Settings().Meta.AppName,
+		ParentName:  strings.TrimSpace(parent.FirstName + " " + parent.LastName),
+		StudentName: studentName,
+		Detention:   note.NextStep,
+		Date:        date,
+		Reason:      note.BehaviorType,
+		Notes:       note.Notes,
+		ReportedBy:  note.ReportedBy,
+	})
+	if err != nil {
+		return err
+	}
+
+	message := &mailer.Message{
+		From: mail.Address{
+			Address: app.Settings().Meta.SenderAddress,
+			Name:    app.Settings().Meta.SenderName,
+		},
+		To:      []mail.Address{{Address: parent.Email}},
+		Subject: fmt.Sprintf("Detention for %s on %s", studentName, date),
+		HTML:    htmlBody,
+		Text:    textBody,
+	}
+
+	return sendEmail(app, EmailTypeParentDetention, message)
+}
@@ -0,0 +1,203 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/veritymedia/massolit/pocketbase/managebac"
+)
+
+const (
+	// MaxRentalsPerStudentConfigName is the config row holding how many books
+	// a student can have on loan at once
+	MaxRentalsPerStudentConfigName = "max_rentals_per_student"
+
+	// DefaultMaxRentalsPerStudent is used when the max_rentals_per_student
+	// config row is not set
+	DefaultMaxRentalsPerStudent = 5
+)
+
+// Codes of the loan rules, returned to the UI with each RentalRuleError
+const (
+	RentalRuleCopyOnLoan      = "validation_copy_on_loan"
+	RentalRuleOverdueBooks    = "validation_overdue_books"
+	RentalRuleLimitReached    = "validation_rental_limit"
+	RentalRuleUnknownStudent  = "validation_unknown_student"
+	RentalRuleArchivedStudent = "validation_archived_student"
+)
+
+// RentalRuleError is a loan rule broken by a rental. Field is the rentals
+// field the error is reported against.
+type RentalRuleError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+func (e *RentalRuleError) Error() string {
+	return e.Message
+}
+
+// ErrCopyOnLoan is returned when renting out a copy that is already on loan
+var ErrCopyOnLoan = &RentalRuleError{
+	Field:   "book_instance",
+	Code:    RentalRuleCopyOnLoan,
+	Message: "This copy is already on loan and must be returned first.",
+}
+
+// ValidateRental checks an open rental against the loan rules: a copy can
+// only be on loan once, students with overdue books cannot borrow more,
+// students can have at most max_rentals_per_student books, and rented_to must
+// be a current ManageBac student. Broken rules are returned as a
+// *RentalRuleError. If ManageBac cannot be reached the student is not checked,
+// so the library keeps working.
+func ValidateRental(ctx context.Context, app *pocketbase.PocketBase, client *managebac.Client, record *models.Record) error {
+	bookInstanceID := record.GetString("book_instance")
+	studentID := record.GetString("rented_to")
+
+	onLoan, err := findOpenRentals(app, record.Id, "book_instance = {:value}", bookInstanceID)
+	if err != nil {
+		return err
+	}
+	if len(onLoan) > 0 {
+		return ErrCopyOnLoan
+	}
+
+	studentRentals, err := findOpenRentals(app, record.Id, "rented_to = {:value}", studentID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	overdue := 0
+	for _, rental := range studentRentals {
+		if dueAt := rental.GetDateTime("due_at"); !dueAt.IsZero() && dueAt.Time().Before(now) {
+			overdue++
+		}
+	}
+	if overdue > 0 {
+		return &RentalRuleError{
+			Field:   "rented_to",
+			Code:    RentalRuleOverdueBooks,
+			Message: fmt.Sprintf("This student has %d overdue %s to return first.", overdue, pluralBooks(overdue)),
+		}
+	}
+
+	limit := GetConfigInt(app, MaxRentalsPerStudentConfigName, DefaultMaxRentalsPerStudent)
+	if len(studentRentals) >= limit {
+		return &RentalRuleError{
+			Field:   "rented_to",
+			Code:    RentalRuleLimitReached,
+			Message: fmt.Sprintf("This student already has %d %s on loan, the most allowed.", len(studentRentals), pluralBooks(len(studentRentals))),
+		}
+	}
+
+	return validateRentalStudent(ctx, client, studentID)
+}
+
+// validateRentalStudent checks that studentID is a current ManageBac student
+func validateRentalStudent(ctx context.Context, client *managebac.Client, studentID string) error {
+	if client == nil {
+		return nil
+	}
+
+	student, err := client.GetStudent(ctx, studentID)
+	if errors.Is(err, managebac.ErrNotFound) {
+		return &RentalRuleError{
+			Field:   "rented_to",
+			Code:    RentalRuleUnknownStudent,
+			Message: "This student could not be found in ManageBac.",
+		}
+	}
+	if err != nil {
+		log.Printf("Error checking rental student %s in ManageBac, allowing the rental: %v", studentID, err)
+		return nil
+	}
+
+	if student.Archived {
+		return &RentalRuleError{
+			Field:   "rented_to",
+			Code:    RentalRuleArchivedStudent,
+			Message: "This student is archived in ManageBac.",
+		}
+	}
+
+	return nil
+}
+
+// findOpenRentals returns the rentals not yet returned matching filter, which
+// compares a field with {:value}, leaving out the rental excludeID
+func findOpenRentals(app *pocketbase.PocketBase, excludeID string, filter string, value string) ([]*models.Record, error) {
+	records, err := app.Dao().FindRecordsByFilter(
+		"rentals",
+		"returned_at = '' && id != {:exclude} && "+filter,
+		"",
+		0,
+		0,
+		dbx.Params{"exclude": excludeID, "value": value},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying open rentals: %v", err)
+	}
+
+	return records, nil
+}
+
+// IsOpenRentalChange reports whether an update to a rental changes who or what
+// is on loan, so the loan rules need checking again
+func IsOpenRentalChange(record *models.Record) bool {
+	original := record.OriginalCopy()
+
+	if !record.GetDateTime("returned_at").IsZero() {
+		return false
+	}
+
+	return record.GetString("book_instance") != original.GetString("book_instance") ||
+		record.GetString("rented_to") != original.GetString("rented_to") ||
+		!original.GetDateTime("returned_at").IsZero()
+}
+
+// ServerRentalFields are kept up to date by the server: set when a rental is
+// made, returned with POST /rentals/:id/return and by the overdue reminders
+var ServerRentalFields = []string{"due_at", "reminders_sent", "last_reminded_at", "returned_at"}
+
+// ChangedServerRentalFields returns the ServerRentalFields an update to a
+// rental changes
+func ChangedServerRentalFields(record *models.Record) []string {
+	original := record.OriginalCopy()
+
+	var changed []string
+	for _, field := range ServerRentalFields {
+		if record.GetString(field) != original.GetString(field) {
+			changed = append(changed, field)
+		}
+	}
+
+	return changed
+}
+
+// PresetServerRentalFields returns the ServerRentalFields a new rental sets,
+// other than due_at which is always worked out when the rental is created
+func PresetServerRentalFields(record *models.Record) []string {
+	var set []string
+	for _, field := range []string{"reminders_sent", "last_reminded_at", "returned_at"} {
+		if value := record.GetString(field); value != "" && value != "0" {
+			set = append(set, field)
+		}
+	}
+
+	return set
+}
+
+func pluralBooks(n int) string {
+	if n == 1 {
+		return "book"
+	}
+	return "books"
+}
@@ -0,0 +1,188 @@
+package tasks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	RentalConditionGood    = "good"
+	RentalConditionDamaged = "damaged"
+	RentalConditionLost    = "lost"
+)
+
+const (
+	// DefaultLoanDaysConfigName is the config row holding the loan period of
+	// books without one of their own or for their department
+	DefaultLoanDaysConfigName = "default_loan_days"
+
+	// DefaultLoanDays is used when the default_loan_days config row is not set
+	DefaultLoanDays = 14
+)
+
+var (
+	// ErrRentalReturned is returned when returning a rental that is already closed
+	ErrRentalReturned = errors.New("this rental has already been returned")
+	// ErrInvalidRentalCondition is returned for an unknown return condition
+	ErrInvalidRentalCondition = errors.New("condition must be good, damaged or lost")
+)
+
+// LoanHistoryEntry is a single rental of a book copy, returned or not
+type LoanHistoryEntry struct {
+	RentalID       string          `json:"rental_id"`
+	RentedTo       string          `json:"rented_to"`
+	BookInstanceID string          `json:"book_instance_id"`
+	BookCode       string          `json:"book_code"`
+	BookID         string          `json:"book_id"`
+	Title          string          `json:"title"`
+	ISBN           string          `json:"isbn"`
+	RentedAt       types.DateTime  `json:"rented_at"`
+	DueAt          *types.DateTime `json:"due_at"`
+	ReturnedAt     *types.DateTime `json:"returned_at"`
+	DaysOut        int             `json:"days_out"`
+	Condition      string          `json:"condition"`
+	ConditionNotes string          `json:"condition_notes"`
+}
+
+// ReturnRental closes a rental, recording when the book came back and its
+// condition. Rentals are kept as loan history rather than deleted.
+func ReturnRental(app *pocketbase.PocketBase, id string, condition string, notes string) (*models.Record, error) {
+	switch condition {
+	case "":
+		condition = RentalConditionGood
+	case RentalConditionGood, RentalConditionDamaged, RentalConditionLost:
+	default:
+		return nil, ErrInvalidRentalCondition
+	}
+
+	record, err := app.Dao().FindRecordById("rentals", id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding rental %s: %w", id, err)
+	}
+
+	if !record.GetDateTime("returned_at").IsZero() {
+		return nil, ErrRentalReturned
+	}
+
+	record.Set("returned_at", types.NowDateTime())
+	record.Set("condition", condition)
+	record.Set("condition_notes", notes)
+
+	if err := app.Dao().SaveRecord(record); err != nil {
+		return nil, fmt.Errorf("error saving rental %s: %v", id, err)
+	}
+
+	return record, nil
+}
+
+// GetCopyLoanHistory returns every rental of a book instance, newest first
+func GetCopyLoanHistory(app *pocketbase.PocketBase, bookInstanceID string) ([]LoanHistoryEntry, error) {
+	return findLoanHistory(app, "book_instance = {:id}", dbx.Params{"id": bookInstanceID})
+}
+
+// GetStudentLoanHistory returns every rental to a ManageBac student, newest
+// first
+func GetStudentLoanHistory(app *pocketbase.PocketBase, studentID string) ([]LoanHistoryEntry, error) {
+	return findLoanHistory(app, "rented_to = {:id}", dbx.Params{"id": studentID})
+}
+
+func findLoanHistory(app *pocketbase.PocketBase, filter string, params dbx.Params) ([]LoanHistoryEntry, error) {
+	records, err := app.Dao().FindRecordsByFilter("rentals", filter, "-created", 0, 0, params)
+	if err != nil {
+		return nil, fmt.Errorf("error querying rentals: %v", err)
+	}
+
+	if errs := app.Dao().ExpandRecords(records, []string{"book_instance.book"}, nil); len(errs) > 0 {
+		return nil, fmt.Errorf("error expanding rentals: %v", errs)
+	}
+
+	history := make([]LoanHistoryEntry, 0, len(records))
+	for _, record := range records {
+		history = append(history, loanHistoryEntryFromRecord(record))
+	}
+
+	return history, nil
+}
+
+func loanHistoryEntryFromRecord(record *models.Record) LoanHistoryEntry {
+	entry := LoanHistoryEntry{
+		RentalID:       record.Id,
+		RentedTo:       record.GetString("rented_to"),
+		BookInstanceID: record.GetString("book_instance"),
+		RentedAt:       record.Created,
+		Condition:      record.GetString("condition"),
+		ConditionNotes: record.GetString("condition_notes"),
+	}
+
+	if instance := record.ExpandedOne("book_instance"); instance != nil {
+		entry.BookCode = instance.GetString("book_code")
+		entry.BookID = instance.GetString("book")
+
+		if book := instance.ExpandedOne("book"); book != nil {
+			entry.Title = book.GetString("title")
+			entry.ISBN = book.GetString("isbn")
+		}
+	}
+
+	if dueAt := record.GetDateTime("due_at"); !dueAt.IsZero() {
+		entry.DueAt = &dueAt
+	}
+
+	until := time.Now()
+	if returnedAt := record.GetDateTime("returned_at"); !returnedAt.IsZero() {
+		entry.ReturnedAt = &returnedAt
+		until = returnedAt.Time()
+	}
+	entry.DaysOut = int(until.Sub(record.Created.Time()).Hours() / 24)
+
+	return entry
+}
+
+// LoanDays returns how many days a book can be borrowed for. A loan period
+// set on the book wins, then one set for the book's department in
+// loan_periods, then the default_loan_days config row.
+func LoanDays(app *pocketbase.PocketBase, book *models.Record) (int, error) {
+	if days := book.GetInt("loan_days"); days > 0 {
+		return days, nil
+	}
+
+	if department := strings.TrimSpace(book.GetString("department")); department != "" {
+		period, err := app.Dao().FindFirstRecordByFilter("loan_periods", "department = {:department}", dbx.Params{"department": department})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("error finding loan period of department %s: %v", department, err)
+		}
+		if period != nil && period.GetInt("loan_days") > 0 {
+			return period.GetInt("loan_days"), nil
+		}
+	}
+
+	return GetConfigInt(app, DefaultLoanDaysConfigName, DefaultLoanDays), nil
+}
+
+// RentalDueDate returns when a copy rented out at from is due back
+func RentalDueDate(app *pocketbase.PocketBase, bookInstanceID string, from time.Time) (types.DateTime, error) {
+	instance, err := app.Dao().FindRecordById("book_instances", bookInstanceID)
+	if err != nil {
+		return types.DateTime{}, fmt.Errorf("error finding book instance %s: %w", bookInstanceID, err)
+	}
+
+	book, err := app.Dao().FindRecordById("books", instance.GetString("book"))
+	if err != nil {
+		return types.DateTime{}, fmt.Errorf("error finding book of instance %s: %w", bookInstanceID, err)
+	}
+
+	days, err := LoanDays(app, book)
+	if err != nil {
+		return types.DateTime{}, err
+	}
+
+	return types.ParseDateTime(from.AddDate(0, 0, days))
+}
@@ -0,0 +1,168 @@
+package tasks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/cron"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	ReportTriggerScheduled = "scheduled"
+	ReportTriggerCatchUp   = "catch_up"
+
+	ReportRunRunning = "running"
+	ReportRunSent    = "sent"
+	ReportRunEmpty   = "empty"
+	ReportRunFailed  = "failed"
+)
+
+// reportRunStaleAfter is how long a run may stay running before it is assumed
+// to have been interrupted and another run may take over
+const reportRunStaleAfter = time.Hour
+
+// ErrReportAlreadyRun is returned when a report has already been sent for the
+// period, or is being sent right now
+var ErrReportAlreadyRun = errors.New("report has already been run for this period")
+
+// reportPeriod is the key identifying a daily report run. Days are UTC, the
+// same as the cron scheduler.
+func reportPeriod(day time.Time) string {
+	return day.UTC().Format("2006-01-02")
+}
+
+// claimReportRun records that the report for period is being sent. It returns
+// ErrReportAlreadyRun if another run has finished or is still in progress, so
+// each report is only sent once per period. Failed runs may be retried.
+func claimReportRun(app *pocketbase.PocketBase, reportType string, period string, trigger string) (*models.Record, error) {
+	startedAt := types.NowDateTime()
+
+	record, err := app.Dao().FindFirstRecordByFilter(
+		"report_runs",
+		"report_type = {:type} && period = {:period}",
+		dbx.Params{"type": reportType, "period": period},
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error finding report run: %v", err)
+	}
+
+	if record == nil {
+		collection, err := app.Dao().FindCollectionByNameOrId("report_runs")
+		if err != nil {
+			return nil, fmt.Errorf("error finding report_runs collection: %v", err)
+		}
+
+		record = models.NewRecord(collection)
+		record.Set("report_type", reportType)
+		record.Set("period", period)
+	} else {
+		switch record.GetString("status") {
+		case ReportRunSent, ReportRunEmpty:
+			return nil, ErrReportAlreadyRun
+		case ReportRunRunning:
+			if time.Since(record.GetDateTime("started_at").Time()) < reportRunStaleAfter {
+				return nil, ErrReportAlreadyRun
+			}
+		}
+	}
+
+	record.Set("trigger", trigger)
+	record.Set("status", ReportRunRunning)
+	record.Set("started_at", startedAt)
+	record.Set("finished_at", "")
+	record.Set("error", "")
+
+	// The unique index on report_type and period stops two new runs for the
+	// same period being created at once
+	if err := app.Dao().SaveRecord(record); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrReportAlreadyRun, err)
+	}
+
+	return record, nil
+}
+
+// lastReportRunStart returns when the last successful run of reportType for a
+// period before period started, or the zero time if there is none
+func lastReportRunStart(app *pocketbase.PocketBase, reportType string, period string) (time.Time, error) {
+	records, err := app.Dao().FindRecordsByFilter(
+		"report_runs",
+		"report_type = {:type} && period < {:period} && (status = {:sent} || status = {:empty})",
+		"-period",
+		1,
+		0,
+		dbx.Params{"type": reportType, "period": period, "sent": ReportRunSent, "empty": ReportRunEmpty},
+	)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error finding last %s run: %v", reportType, err)
+	}
+	if len(records) == 0 {
+		return time.Time{}, nil
+	}
+
+	return records[0].GetDateTime("started_at").Time(), nil
+}
+
+// finishReportRun records the outcome of a claimed run
+func finishReportRun(app *pocketbase.PocketBase, record *models.Record, status string, runErr error) {
+	record.Set("status", status)
+	record.Set("finished_at", types.NowDateTime())
+	if runErr != nil {
+		record.Set("error", runErr.Error())
+	}
+
+	if err := app.Dao().SaveRecord(record); err != nil {
+		log.Printf("Error saving report run: %v", err)
+	}
+}
+
+// MissedRunTime returns the latest time today, within grace before now, that
+// schedule was due. It returns false if the schedule was not due in that time.
+func MissedRunTime(schedule string, now time.Time, grace time.Duration) (time.Time, bool, error) {
+	parsed, err := cron.NewSchedule(schedule)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	now = now.UTC().Truncate(time.Minute)
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	for t := now; !t.Before(dayStart) && now.Sub(t) <= grace; t = t.Add(-time.Minute) {
+		if parsed.IsDue(cron.NewMoment(t)) {
+			return t, true, nil
+		}
+	}
+
+	return time.Time{}, false, nil
+}
+
+// CatchUpDetentionReport sends today's detention report if its scheduled time
+// passed within grace while the server was down and it has not been sent yet
+func CatchUpDetentionReport(app *pocketbase.PocketBase, schedule string, mode ReportMode, grace time.Duration) error {
+	if grace <= 0 {
+		return nil
+	}
+
+	dueAt, missed, err := MissedRunTime(schedule, time.Now(), grace)
+	if err != nil {
+		return fmt.Errorf("invalid detention report schedule '%s': %v", schedule, err)
+	}
+	if !missed {
+		return nil
+	}
+
+	fmt.Printf("CRON::DETENTION_REPORT Checking for a missed report scheduled at %s\n", dueAt.Format(time.RFC3339))
+
+	err = HandleDetentionReportSend(app, mode, ReportTriggerCatchUp)
+	if errors.Is(err, ErrReportAlreadyRun) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,211 @@
+package tasks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/tools/cron"
+)
+
+// DetentionReportScheduleConfigName is the config row holding the cron
+// expression of the daily detention report
+const DetentionReportScheduleConfigName = "detention_report_schedule"
+
+const (
+	ScheduleSourceConfig  = "config"
+	ScheduleSourceDefault = "default"
+)
+
+// ScheduledJob is a task run by the Scheduler. Its cron expression is read
+// from the config row ConfigName, falling back to DefaultSchedule.
+type ScheduledJob struct {
+	ID              string
+	ConfigName      string
+	DefaultSchedule string
+	Run             func()
+}
+
+// JobStatus describes a registered job for the admin API
+type JobStatus struct {
+	ID         string     `json:"id"`
+	ConfigName string     `json:"config_name"`
+	Schedule   string     `json:"schedule"`
+	Source     string     `json:"source"`
+	NextRun    *time.Time `json:"next_run"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Scheduler runs ScheduledJobs on the PocketBase cron scheduler and reloads
+// their schedules when the config collection changes
+type Scheduler struct {
+	app  *pocketbase.PocketBase
+	cron *cron.Cron
+
+	mu       sync.Mutex
+	jobs     map[string]ScheduledJob
+	statuses map[string]JobStatus
+}
+
+// NewScheduler creates a scheduler using UTC, like the cron scheduler it wraps
+func NewScheduler(app *pocketbase.PocketBase) *Scheduler {
+	return &Scheduler{
+		app:      app,
+		cron:     cron.New(),
+		jobs:     map[string]ScheduledJob{},
+		statuses: map[string]JobStatus{},
+	}
+}
+
+// Register adds a job and schedules it. It returns an error only if neither
+// the configured nor the default schedule is valid.
+func (s *Scheduler) Register(job ScheduledJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = job
+
+	return s.load(job)
+}
+
+// Start starts running the registered jobs
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop stops running jobs
+func (s *Scheduler) Stop() {
+	s.cron.Stop()
+}
+
+// ReloadConfig reschedules the jobs using the config row name, if any
+func (s *Scheduler) ReloadConfig(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.ConfigName != name {
+			continue
+		}
+
+		if err := s.load(job); err != nil {
+			log.Printf("Error reloading schedule of %s: %v", job.ID, err)
+		}
+	}
+}
+
+// IsScheduleConfig reports whether the config row name holds a job schedule
+func (s *Scheduler) IsScheduleConfig(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.ConfigName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Schedule returns the cron expression job id is currently running on
+func (s *Scheduler) Schedule(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.statuses[id].Schedule
+}
+
+// Jobs lists the registered jobs with the next time each will run
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	jobs := make([]JobStatus, 0, len(s.statuses))
+	for _, status := range s.statuses {
+		if schedule, err := cron.NewSchedule(status.Schedule); err == nil {
+			if next, ok := nextRunTime(schedule, now); ok {
+				status.NextRun = &next
+			}
+		}
+		jobs = append(jobs, status)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID < jobs[j].ID
+	})
+
+	return jobs
+}
+
+// load adds job to the cron scheduler with its configured schedule, falling
+// back to the default if the config row is missing or invalid
+func (s *Scheduler) load(job ScheduledJob) error {
+	status := JobStatus{
+		ID:         job.ID,
+		ConfigName: job.ConfigName,
+		Schedule:   job.DefaultSchedule,
+		Source:     ScheduleSourceDefault,
+	}
+
+	configured, err := GetConfigValue(s.app, job.ConfigName)
+	configured = strings.TrimSpace(configured)
+
+	switch {
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		status.Error = err.Error()
+		log.Printf("Error reading schedule of %s, using default %s: %v", job.ID, job.DefaultSchedule, err)
+	case configured != "":
+		if err := ValidateSchedule(configured); err != nil {
+			status.Error = err.Error()
+			fmt.Printf("ERROR: Invalid schedule '%s' for %s, using default %s\n", configured, job.ID, job.DefaultSchedule)
+		} else {
+			status.Schedule = configured
+			status.Source = ScheduleSourceConfig
+		}
+	}
+
+	if err := s.cron.Add(job.ID, status.Schedule, job.Run); err != nil {
+		s.cron.Remove(job.ID)
+		delete(s.statuses, job.ID)
+		return fmt.Errorf("failed to schedule %s: %v", job.ID, err)
+	}
+
+	s.statuses[job.ID] = status
+	fmt.Printf("CRON::SCHEDULER Scheduled %s with %s (%s)\n", job.ID, status.Schedule, status.Source)
+
+	return nil
+}
+
+// ValidateSchedule checks that schedule is a cron expression the scheduler
+// understands
+func ValidateSchedule(schedule string) error {
+	if _, err := cron.NewSchedule(strings.TrimSpace(schedule)); err != nil {
+		return fmt.Errorf("invalid cron expression '%s': %v", schedule, err)
+	}
+
+	return nil
+}
+
+// nextRunTime finds the next minute after from that schedule is due, looking
+// up to a year ahead
+func nextRunTime(schedule *cron.Schedule, from time.Time) (time.Time, bool) {
+	t := from.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(1, 0, 0)
+
+	for ; t.Before(limit); t = t.Add(time.Minute) {
+		if schedule.IsDue(cron.NewMoment(t)) {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
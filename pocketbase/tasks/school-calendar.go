@@ -0,0 +1,256 @@
+package tasks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	CalendarTypeTerm    = "term"
+	CalendarTypeHoliday = "holiday"
+	CalendarTypeInset   = "inset"
+
+	// CalendarTypeAuto picks the type of each imported event from its summary
+	CalendarTypeAuto = "auto"
+)
+
+// CalendarImportResult summarises an ICS import
+type CalendarImportResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	// Skipped are the events whose type could not be told from their summary.
+	// They are left for an admin to add with the right type.
+	Skipped []CalendarEvent `json:"skipped"`
+}
+
+// IsTeachingDay reports whether day (a UTC calendar day) is a school day: a
+// weekday within a term that is not a holiday or INSET day. While no terms
+// have been added every weekday counts as within term.
+func IsTeachingDay(app *pocketbase.PocketBase, day time.Time) (bool, error) {
+	day = day.UTC()
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		return false, nil
+	}
+
+	from, _ := dayRange(day)
+
+	entries, err := app.Dao().FindRecordsByFilter(
+		"school_calendar",
+		"start_date <= {:day} && end_date >= {:day}",
+		"",
+		0,
+		0,
+		dbx.Params{"day": from.String()},
+	)
+	if err != nil {
+		return false, fmt.Errorf("error querying school calendar: %v", err)
+	}
+
+	inTerm := false
+	for _, entry := range entries {
+		switch entry.GetString("type") {
+		case CalendarTypeHoliday, CalendarTypeInset:
+			return false, nil
+		case CalendarTypeTerm:
+			inTerm = true
+		}
+	}
+
+	if inTerm {
+		return true, nil
+	}
+
+	// Outside every term, unless no terms have been set up at all
+	terms, err := app.Dao().FindRecordsByFilter("school_calendar", "type = {:type}", "", 1, 0, dbx.Params{"type": CalendarTypeTerm})
+	if err != nil {
+		return false, fmt.Errorf("error querying school terms: %v", err)
+	}
+
+	return len(terms) == 0, nil
+}
+
+// FindTerm returns the term containing day. The error wraps sql.ErrNoRows if
+// day is not in a term.
+func FindTerm(app *pocketbase.PocketBase, day time.Time) (*models.Record, error) {
+	from, _ := dayRange(day.UTC())
+
+	record, err := app.Dao().FindFirstRecordByFilter(
+		"school_calendar",
+		"type = {:type} && start_date <= {:day} && end_date >= {:day}",
+		dbx.Params{"type": CalendarTypeTerm, "day": from.String()},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not find the term containing %s: %w", from.Time().Format("2006-01-02"), err)
+	}
+
+	return record, nil
+}
+
+// FindPreviousTerm returns the last term ending before day, or nil if there
+// is none
+func FindPreviousTerm(app *pocketbase.PocketBase, day time.Time) (*models.Record, error) {
+	from, _ := dayRange(day.UTC())
+
+	records, err := app.Dao().FindRecordsByFilter(
+		"school_calendar",
+		"type = {:type} && end_date < {:day}",
+		"-end_date",
+		1,
+		0,
+		dbx.Params{"type": CalendarTypeTerm, "day": from.String()},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying school terms: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	return records[0], nil
+}
+
+// IsLastTeachingDayOfTerm reports whether day is a teaching day and no other
+// teaching days follow it before the end of its term
+func IsLastTeachingDayOfTerm(app *pocketbase.PocketBase, day time.Time) (bool, error) {
+	term, err := FindTerm(app, day)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if teaching, err := IsTeachingDay(app, day); err != nil || !teaching {
+		return false, err
+	}
+
+	from, _ := dayRange(day.UTC())
+	end := term.GetDateTime("end_date").Time()
+
+	for next := from.Time().AddDate(0, 0, 1); !next.After(end); next = next.AddDate(0, 0, 1) {
+		teaching, err := IsTeachingDay(app, next)
+		if err != nil {
+			return false, err
+		}
+		if teaching {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// classifyCalendarEvent guesses whether an imported event is a term, holiday
+// or INSET day from its summary. It returns "" for anything else, as calendar
+// feeds also hold ordinary school events like sports days. Words are matched
+// whole and holidays are checked before terms, so "Half term" is a holiday and
+// "Mid-term review" is neither.
+func classifyCalendarEvent(summary string) string {
+	words := strings.FieldsFunc(strings.ToLower(summary), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+
+	switch {
+	case hasPhrase(words, "inset") || hasPhrase(words, "training", "day") || hasPhrase(words, "staff", "development"):
+		return CalendarTypeInset
+	case hasPhrase(words, "half", "term") || hasPhrase(words, "half-term") || hasPhrase(words, "holiday") ||
+		hasPhrase(words, "holidays") || hasPhrase(words, "break") || hasPhrase(words, "vacation"):
+		return CalendarTypeHoliday
+	case hasPhrase(words, "term"):
+		return CalendarTypeTerm
+	default:
+		return ""
+	}
+}
+
+// hasPhrase reports whether phrase appears in words as consecutive whole words
+func hasPhrase(words []string, phrase ...string) bool {
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(phrase)], phrase) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ImportCalendarEvents saves events to the school_calendar collection as
+// calendarType, or CalendarTypeAuto to classify each event by its summary.
+// Events imported before are matched on their ICS UID and updated. Events
+// that cannot be classified keep the type of their existing entry, and are
+// skipped if they have none.
+func ImportCalendarEvents(app *pocketbase.PocketBase, events []CalendarEvent, calendarType string) (CalendarImportResult, error) {
+	result := CalendarImportResult{Skipped: []CalendarEvent{}}
+
+	collection, err := app.Dao().FindCollectionByNameOrId("school_calendar")
+	if err != nil {
+		return result, fmt.Errorf("error finding school_calendar collection: %v", err)
+	}
+
+	err = app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		for _, event := range events {
+			var record *models.Record
+			if event.UID != "" {
+				record, err = txDao.FindFirstRecordByFilter("school_calendar", "ics_uid = {:uid}", dbx.Params{"uid": event.UID})
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("error finding calendar entry %s: %v", event.UID, err)
+				}
+			}
+
+			typ := calendarType
+			if typ == CalendarTypeAuto {
+				typ = classifyCalendarEvent(event.Summary)
+			}
+			if typ == "" && record != nil {
+				typ = record.GetString("type")
+			}
+			if typ == "" {
+				result.Skipped = append(result.Skipped, event)
+				continue
+			}
+
+			if record == nil {
+				record = models.NewRecord(collection)
+				result.Created++
+			} else {
+				result.Updated++
+			}
+
+			start, _ := types.ParseDateTime(event.Start)
+			end, _ := types.ParseDateTime(event.End)
+
+			name := event.Summary
+			if name == "" {
+				name = typ
+			}
+
+			record.Set("name", name)
+			record.Set("type", typ)
+			record.Set("start_date", start)
+			record.Set("end_date", end)
+			record.Set("ics_uid", event.UID)
+
+			if err := txDao.SaveRecord(record); err != nil {
+				return fmt.Errorf("error saving calendar entry %q: %v", name, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return CalendarImportResult{}, err
+	}
+
+	return result, nil
+}
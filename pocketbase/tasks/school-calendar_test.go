@@ -0,0 +1,32 @@
+package tasks
+
+import "testing"
+
+func TestClassifyCalendarEvent(t *testing.T) {
+	tests := []struct {
+		summary string
+		want    string
+	}{
+		{"Autumn Term", CalendarTypeTerm},
+		{"Term 2 begins", CalendarTypeTerm},
+		{"End of term", CalendarTypeTerm},
+		{"Half Term", CalendarTypeHoliday},
+		{"Autumn half-term", CalendarTypeHoliday},
+		{"Christmas Holidays", CalendarTypeHoliday},
+		{"Spring Break", CalendarTypeHoliday},
+		{"INSET Day", CalendarTypeInset},
+		{"Staff training day", CalendarTypeInset},
+		{"Staff Development (no students)", CalendarTypeInset},
+		{"Mid-term review", ""},
+		{"Determination day", ""},
+		{"Terms and conditions briefing", ""},
+		{"Sports Day", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := classifyCalendarEvent(tt.summary); got != tt.want {
+			t.Errorf("classifyCalendarEvent(%q) = %q, want %q", tt.summary, got, tt.want)
+		}
+	}
+}